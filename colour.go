@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/marc-harry/k8s-info/kubeinfo"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Highlight levels of a table cell
+const (
+	levelNone = iota
+	levelWarning
+	levelCritical
+)
+
+var (
+	// colourEnabled whether table cells are highlighted
+	colourEnabled bool
+	// colourThresholds levels at which cells are highlighted, config file values are merged over the defaults
+	colourThresholds = defaultThresholds()
+)
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
+
+func defaultThresholds() thresholds {
+	return thresholds{
+		CPU:      threshold{Warning: floatPointer(70), Critical: floatPointer(90)},
+		Memory:   threshold{Warning: floatPointer(75), Critical: floatPointer(90)},
+		Restarts: threshold{Warning: floatPointer(1), Critical: floatPointer(5)},
+		Disk:     threshold{Warning: floatPointer(80), Critical: floatPointer(90)},
+		Throttling: threshold{
+			Warning:  floatPointer(kubeinfo.ThrottlingWarning),
+			Critical: floatPointer(kubeinfo.ThrottlingCritical),
+		},
+		MemoryLimit: threshold{
+			Warning:  floatPointer(kubeinfo.MemoryLimitWarning),
+			Critical: floatPointer(kubeinfo.MemoryLimitCritical),
+		},
+		NodeState: stateThreshold{Warning: []string{"Unknown"}, Critical: []string{"Not Ready"}},
+	}
+}
+
+// riskThresholds configured throttling and memory limit levels, so the risk view flags the containers it colours
+func riskThresholds() *kubeinfo.RiskThresholds {
+	return &kubeinfo.RiskThresholds{
+		ThrottlingWarning:   *colourThresholds.Throttling.Warning,
+		ThrottlingCritical:  *colourThresholds.Throttling.Critical,
+		MemoryLimitWarning:  *colourThresholds.MemoryLimit.Warning,
+		MemoryLimitCritical: *colourThresholds.MemoryLimit.Critical,
+	}
+}
+
+// colourSupported colour is only written to terminals, and never when NO_COLOR is set
+func colourSupported() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// level highlight level of the value, either limit may be left unset
+func (t threshold) level(value string) int {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return levelNone
+	}
+	if t.Critical != nil && number >= *t.Critical {
+		return levelCritical
+	}
+	if t.Warning != nil && number >= *t.Warning {
+		return levelWarning
+	}
+	return levelNone
+}
+
+func (t stateThreshold) level(value string) int {
+	for _, state := range t.Critical {
+		if state == value {
+			return levelCritical
+		}
+	}
+	for _, state := range t.Warning {
+		if state == value {
+			return levelWarning
+		}
+	}
+	return levelNone
+}
+
+func cellLevel(col column, value string) int {
+	switch col.Name {
+	case "cpu%":
+		return colourThresholds.CPU.level(value)
+	case "mem%":
+		return colourThresholds.Memory.level(value)
+	case "restarts-1h":
+		return colourThresholds.Restarts.level(value)
+	case "rootfs%", "imagefs%", "ephemeral%":
+		return colourThresholds.Disk.level(value)
+	case "throttled%":
+		return colourThresholds.Throttling.level(value)
+	case "mem-limit%":
+		return colourThresholds.MemoryLimit.level(value)
+	case "state":
+		return colourThresholds.NodeState.level(value)
+	case "crash-loop":
+		if value != "" {
+			return levelCritical
+		}
+	case "metric-age":
+		if strings.HasSuffix(value, staleMarker) {
+			return levelWarning
+		}
+	}
+	return levelNone
+}
+
+// colourCell wrap the value in the colour of its level, tablewriter ignores the escape codes when sizing columns
+func colourCell(col column, value string) string {
+	if !colourEnabled {
+		return value
+	}
+	switch cellLevel(col, value) {
+	case levelCritical:
+		return fmt.Sprintf("\033[%dm%s\033[0m", tablewriter.FgRedColor, value)
+	case levelWarning:
+		return fmt.Sprintf("\033[%dm%s\033[0m", tablewriter.FgYellowColor, value)
+	}
+	return value
+}
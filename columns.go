@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marc-harry/k8s-info/kubeinfo"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// column field a table can show, chosen by name with --columns
+type column struct {
+	Name   string
+	Header string
+	// Hidden only shown when asked for
+	Hidden bool
+	// Duration holds the time since an event, sorted by duration rather than text
+	Duration bool
+	// Kubelet needs the kubelet stats summary of each node, only read when such a column is shown
+	Kubelet bool
+}
+
+// tableRow cell values by column name
+type tableRow map[string]string
+
+// labelPrefix prefix of the column names of label values added with -L
+const labelPrefix = "label:"
+
+// viewColumns registry of the fields available in each table
+var viewColumns = map[string][]column{
+	"nodes": {
+		{Name: "node", Header: "Node"},
+		{Name: "cpu", Header: "CPU Usage"},
+		{Name: "cpu%", Header: "CPU %"},
+		{Name: "mem", Header: "Mem Usage"},
+		{Name: "mem%", Header: "Mem %"},
+		{Name: "pods", Header: "Pod Count"},
+		{Name: "state", Header: "State"},
+		{Name: "warnings", Header: "Warnings"},
+		{Name: "cpu-alloc", Header: "CPU Allocatable", Hidden: true},
+		{Name: "mem-alloc", Header: "Mem Allocatable", Hidden: true},
+		{Name: "zone", Header: "Zone", Hidden: true},
+		{Name: "kubelet", Header: "Kubelet Version", Hidden: true},
+		{Name: "ip", Header: "Internal IP", Hidden: true},
+		{Name: "age", Header: "Age", Hidden: true, Duration: true},
+		{Name: "metric-age", Header: "Metric Age", Hidden: true, Duration: true},
+		{Name: "metric-window", Header: "Metric Window", Hidden: true, Duration: true},
+		{Name: "rx", Header: "Net Rx/s", Hidden: true, Kubelet: true},
+		{Name: "tx", Header: "Net Tx/s", Hidden: true, Kubelet: true},
+		{Name: "rootfs", Header: "Root FS", Hidden: true, Kubelet: true},
+		{Name: "rootfs%", Header: "Root FS %", Hidden: true, Kubelet: true},
+		{Name: "imagefs", Header: "Image FS", Hidden: true, Kubelet: true},
+		{Name: "imagefs%", Header: "Image FS %", Hidden: true, Kubelet: true},
+		{Name: "working-set", Header: "Working Set", Hidden: true, Kubelet: true},
+		{Name: "rss", Header: "RSS", Hidden: true, Kubelet: true},
+	},
+	"nodegroups": {
+		{Name: "group", Header: "Group"},
+		{Name: "nodes", Header: "Node Count"},
+		{Name: "cpu", Header: "CPU Usage"},
+		{Name: "cpu-alloc", Header: "CPU Allocatable"},
+		{Name: "cpu%", Header: "CPU %"},
+		{Name: "mem", Header: "Mem Usage"},
+		{Name: "mem-alloc", Header: "Mem Allocatable"},
+		{Name: "mem%", Header: "Mem %"},
+		{Name: "pods", Header: "Pod Count"},
+	},
+	"pods": {
+		{Name: "pod", Header: "Pod"},
+		{Name: "namespace", Header: "Namespace", Hidden: true},
+		{Name: "node", Header: "Node"},
+		{Name: "cpu", Header: "CPU Usage"},
+		{Name: "cpu%", Header: "CPU %"},
+		{Name: "mem", Header: "Mem Usage"},
+		{Name: "mem%", Header: "Mem %"},
+		{Name: "status", Header: "Status"},
+		{Name: "uptime", Header: "Up time", Duration: true},
+		{Name: "restarts", Header: "Restarts"},
+		{Name: "restarts-1h", Header: "Restarts 1h"},
+		{Name: "last-restart", Header: "Last Restart", Duration: true},
+		{Name: "crash-loop", Header: "Crash Loop"},
+		{Name: "ready", Header: "Ready", Hidden: true},
+		{Name: "age", Header: "Age", Hidden: true, Duration: true},
+		{Name: "ip", Header: "Pod IP", Hidden: true},
+		{Name: "host-ip", Header: "Host IP", Hidden: true},
+		{Name: "qos", Header: "QoS Class", Hidden: true},
+		{Name: "owner", Header: "Owner", Hidden: true},
+		{Name: "metric-age", Header: "Metric Age", Hidden: true, Duration: true},
+		{Name: "metric-window", Header: "Metric Window", Hidden: true, Duration: true},
+		{Name: "rx", Header: "Net Rx/s", Hidden: true, Kubelet: true},
+		{Name: "tx", Header: "Net Tx/s", Hidden: true, Kubelet: true},
+		{Name: "ephemeral", Header: "Ephemeral", Hidden: true, Kubelet: true},
+		{Name: "ephemeral-limit", Header: "Ephemeral Limit", Hidden: true, Kubelet: true},
+		{Name: "ephemeral%", Header: "Ephemeral %", Hidden: true, Kubelet: true},
+		{Name: "working-set", Header: "Working Set", Hidden: true, Kubelet: true},
+		{Name: "rss", Header: "RSS", Hidden: true, Kubelet: true},
+	},
+	"containers": {
+		{Name: "pod", Header: "Pod"},
+		{Name: "container", Header: "Container"},
+		{Name: "restarts", Header: "Restarts"},
+		{Name: "restarts-1h", Header: "Restarts 1h"},
+		{Name: "reason", Header: "Last Reason"},
+		{Name: "exit-code", Header: "Exit Code"},
+		{Name: "signal", Header: "Signal"},
+		{Name: "last-restart", Header: "Last Restart", Duration: true},
+		{Name: "crash-loop", Header: "Crash Loop"},
+	},
+	"failing": {
+		{Name: "pod", Header: "Pod"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "status", Header: "Status"},
+		{Name: "warnings", Header: "Warnings"},
+	},
+	"namespaces": {
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "pods", Header: "Pods"},
+		{Name: "running", Header: "Running"},
+		{Name: "failing", Header: "Failing"},
+		{Name: "restarts", Header: "Restarts"},
+		{Name: "cpu", Header: "CPU Usage"},
+		{Name: "mem", Header: "Mem Usage"},
+	},
+	"events": {
+		{Name: "object", Header: "Object"},
+		{Name: "kind", Header: "Kind"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "reasons", Header: "Reasons"},
+		{Name: "count", Header: "Count"},
+		{Name: "last-seen", Header: "Last Seen", Duration: true},
+		{Name: "message", Header: "Last Message"},
+	},
+	"storage": {
+		{Name: "claim", Header: "Claim"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "status", Header: "Status"},
+		{Name: "requested", Header: "Requested"},
+		{Name: "volume", Header: "Volume"},
+		{Name: "storage-class", Header: "Storage Class"},
+		{Name: "access-modes", Header: "Access Modes"},
+		{Name: "used", Header: "Used"},
+		{Name: "used%", Header: "Used %"},
+		{Name: "pods", Header: "Pods"},
+	},
+	"volumes": {
+		{Name: "volume", Header: "Unclaimed Volume"},
+		{Name: "status", Header: "Status"},
+		{Name: "capacity", Header: "Capacity"},
+		{Name: "storage-class", Header: "Storage Class"},
+		{Name: "reclaim-policy", Header: "Reclaim Policy"},
+		{Name: "age", Header: "Age", Duration: true},
+	},
+	"pending": {
+		{Name: "pod", Header: "Pending Pod"},
+		{Name: "reason", Header: "Reason"},
+		{Name: "message", Header: "Message"},
+		{Name: "unbound-claims", Header: "Unbound Claims"},
+		{Name: "node-fit", Header: "Node Fit"},
+	},
+	"spread": {
+		{Name: "workload", Header: "Workload"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "replicas", Header: "Replicas"},
+		{Name: "ready", Header: "Ready"},
+		{Name: "nodes", Header: "Nodes"},
+		{Name: "zones", Header: "Zones"},
+		{Name: "node-spread", Header: "Node Spread"},
+		{Name: "zone-spread", Header: "Zone Spread", Hidden: true},
+		{Name: "pdb", Header: "PDB"},
+		{Name: "flags", Header: "Flags"},
+	},
+	"hpa": {
+		{Name: "hpa", Header: "HPA"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "target", Header: "Target"},
+		{Name: "min", Header: "Min"},
+		{Name: "max", Header: "Max"},
+		{Name: "current", Header: "Current"},
+		{Name: "desired", Header: "Desired"},
+		{Name: "cpu", Header: "CPU % Current/Target"},
+		{Name: "measured-cpu", Header: "Measured CPU %"},
+		{Name: "conditions", Header: "Conditions"},
+		{Name: "flags", Header: "Flags"},
+	},
+	"risk": {
+		{Name: "pod", Header: "Pod"},
+		{Name: "namespace", Header: "Namespace"},
+		{Name: "container", Header: "Container"},
+		{Name: "node", Header: "Node", Hidden: true},
+		{Name: "cpu-limit", Header: "CPU Limit"},
+		{Name: "throttled%", Header: "Throttled %"},
+		{Name: "mem", Header: "Working Set"},
+		{Name: "mem-limit", Header: "Mem Limit"},
+		{Name: "mem-limit%", Header: "Mem Limit %"},
+		{Name: "risk", Header: "Risk"},
+	},
+}
+
+// labelViews tables that show the labels given with -L as extra columns
+var labelViews = map[string]bool{"nodes": true, "pods": true}
+
+// dependentColumns columns needing data RBAC may forbid reading, by the unavailable data then view
+var dependentColumns = map[string]map[string][]string{
+	kubeinfo.UnavailableNodes:   {"pods": {"cpu%", "mem%"}, "spread": {"zones", "zone-spread"}},
+	kubeinfo.UnavailableKubelet: {"storage": {"used", "used%"}, "nodes": kubeletColumns("nodes"), "pods": kubeletColumns("pods")},
+}
+
+// kubeletColumns names of the columns of the view that need kubelet stats
+func kubeletColumns(view string) []string {
+	names := []string{}
+	for _, col := range viewColumns[view] {
+		if col.Kubelet {
+			names = append(names, col.Name)
+		}
+	}
+	return names
+}
+
+// showKubeletColumns show every column of the view that needs kubelet stats
+func showKubeletColumns(view string) {
+	for _, name := range kubeletColumns(view) {
+		showColumn(view, name)
+	}
+}
+
+// needsKubelet whether a column shown in the view needs kubelet stats
+func needsKubelet(view string) bool {
+	for _, col := range selectedColumns(view) {
+		if col.Kubelet {
+			return true
+		}
+	}
+	return false
+}
+
+// shownColumns hidden columns shown by default because the data calls for them, by view
+var shownColumns = map[string]map[string]bool{}
+
+// showColumn show a hidden column of the view unless columns were chosen
+func showColumn(view string, name string) {
+	if shownColumns[view] == nil {
+		shownColumns[view] = map[string]bool{}
+	}
+	shownColumns[view][name] = true
+}
+
+// droppedColumns columns left out because their data is unavailable, by view
+var droppedColumns = map[string]map[string]bool{}
+
+// dropUnavailable leave out the columns of the view depending on unavailable data and say why on stderr
+func dropUnavailable(view string, unavailable []string) {
+	seen := map[string]bool{}
+	for _, data := range unavailable {
+		if seen[data] {
+			continue
+		}
+		seen[data] = true
+		dropped := []string{}
+		for _, name := range dependentColumns[data][view] {
+			if droppedColumns[view] == nil {
+				droppedColumns[view] = map[string]bool{}
+			}
+			droppedColumns[view][name] = true
+			if col, ok := findColumn(view, name); ok {
+				dropped = append(dropped, col.Header)
+			}
+		}
+		note := "not allowed to read " + data
+		if len(dropped) > 0 {
+			note += ", leaving out " + strings.Join(dropped, ", ")
+		}
+		fmt.Fprintln(os.Stderr, note)
+	}
+}
+
+// findColumn column of the view by name or header
+func findColumn(view string, name string) (column, bool) {
+	if strings.HasPrefix(name, labelPrefix) && labelViews[view] {
+		key := strings.TrimPrefix(name, labelPrefix)
+		return column{Name: name, Header: labelHeader(key)}, true
+	}
+	for _, col := range viewColumns[view] {
+		if strings.EqualFold(col.Name, name) || strings.EqualFold(col.Header, name) {
+			return col, true
+		}
+	}
+	return column{}, false
+}
+
+// labelHeader header of a label column, like kubectl the upper cased last segment of the key
+func labelHeader(key string) string {
+	return strings.ToUpper(key[strings.LastIndex(key, "/")+1:])
+}
+
+// columnNames describe the columns of a view for help output
+func columnNames(view string) string {
+	shown, hidden := []string{}, []string{}
+	for _, col := range viewColumns[view] {
+		if col.Hidden {
+			hidden = append(hidden, col.Name)
+		} else {
+			shown = append(shown, col.Name)
+		}
+	}
+	result := strings.Join(shown, ",")
+	if len(hidden) > 0 {
+		result += " (also " + strings.Join(hidden, ",") + ")"
+	}
+	return result
+}
+
+// parseColumns resolve a column spec, each entry is a column name or header, or HEADER:name to rename it
+func parseColumns(view string, specs []string) ([]column, error) {
+	columns := []column{}
+	for _, spec := range specs {
+		header := ""
+		if i := strings.Index(spec, ":"); i >= 0 && !strings.HasPrefix(spec, labelPrefix) {
+			header, spec = spec[:i], spec[i+1:]
+		}
+		col, ok := findColumn(view, strings.TrimSpace(spec))
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q for %s, available columns: %s", spec, view, columnNames(view))
+		}
+		if header != "" {
+			col.Header = header
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// validateColumns check the chosen columns and sort columns of every view exist
+func validateColumns() error {
+	for view, specs := range tableColumns {
+		if _, err := parseColumns(view, specs); err != nil {
+			return err
+		}
+	}
+	for view, name := range tableSort {
+		if _, ok := findColumn(view, name); !ok && len(viewColumns[view]) > 0 {
+			return fmt.Errorf("unknown sort column %q for %s, available columns: %s", name, view, columnNames(view))
+		}
+	}
+	return nil
+}
+
+// selectedColumns columns chosen for the view, the visible ones if none were chosen, followed by any label columns
+func selectedColumns(view string) []column {
+	columns, err := parseColumns(view, tableColumns[view])
+	if err != nil || len(columns) == 0 {
+		columns = []column{}
+		for _, col := range viewColumns[view] {
+			if !col.Hidden || shownColumns[view][col.Name] {
+				columns = append(columns, col)
+			}
+		}
+	}
+	available := []column{}
+	for _, col := range columns {
+		if !droppedColumns[view][col.Name] {
+			available = append(available, col)
+		}
+	}
+	columns = available
+	if labelViews[view] {
+		for _, key := range labelColumns {
+			columns = append(columns, column{Name: labelPrefix + key, Header: labelHeader(key)})
+		}
+	}
+	return columns
+}
+
+// addLabels set the label columns of the row
+func addLabels(row tableRow, labels map[string]string) tableRow {
+	for key, value := range labels {
+		row[labelPrefix+key] = value
+	}
+	return row
+}
+
+// sortValue numeric value of a cell, quantities and durations are converted to numbers
+func sortValue(col column, value string) (float64, bool) {
+	// a stale sample is flagged after its value
+	value = strings.TrimSuffix(value, " "+staleMarker)
+	if col.Duration {
+		if len(value) < 2 {
+			return 0, false
+		}
+		count, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return 0, false
+		}
+		units := map[byte]time.Duration{'d': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute, 's': time.Second}
+		return (time.Duration(count) * units[value[len(value)-1]]).Seconds(), true
+	}
+	if number, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil {
+		return number, true
+	}
+	if quantity, err := resource.ParseQuantity(value); err == nil {
+		return float64(quantity.MilliValue()) / 1000, true
+	}
+	return 0, false
+}
+
+// sortRows sort on the named column, numbers largest first and text alphabetically
+func sortRows(view string, rows []tableRow, name string) {
+	col, ok := findColumn(view, name)
+	if !ok {
+		return
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		first, firstOk := sortValue(col, rows[a][col.Name])
+		second, secondOk := sortValue(col, rows[b][col.Name])
+		if firstOk && secondOk {
+			return first > second
+		}
+		if firstOk != secondOk {
+			return firstOk
+		}
+		return rows[a][col.Name] < rows[b][col.Name]
+	})
+}
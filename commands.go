@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// command k8s-info subcommand with its own flags
+type command struct {
+	Name  string
+	Short string
+	Flags *pflag.FlagSet
+	Run   func(service *KubeInfoService) error
+	// RunOptions used instead of Run by commands that do their own connecting
+	RunOptions func(options *globalOptions) error
+}
+
+func newCommand(name, short string) *command {
+	return &command{Name: name, Short: short, Flags: pflag.NewFlagSet(name, pflag.ExitOnError)}
+}
+
+func newCommands() []*command {
+	nodes := newCommand("nodes", "Node usage and state, followed by failing and pending pods")
+	nodeSelector := nodes.Flags.String("node-selector", "", "label selector to filter nodes on")
+	hideFailing := nodes.Flags.Bool("hide-failing", false, "do not list failing and pending pods")
+	nodesSummary := nodes.Flags.Bool("summary", true, "show cluster totals before the table")
+	groupByLabel := nodes.Flags.String("group-by-label", "", "node label to aggregate nodes by, for example topology.kubernetes.io/zone")
+	collapse := nodes.Flags.Bool("collapse", false, "only show the group totals of --group-by-label")
+	nodeKubelet := nodes.Flags.Bool("kubelet-stats", false, "show network, filesystem and memory detail from the kubelet of each node")
+	nodes.Run = func(service *KubeInfoService) error {
+		if *nodeKubelet {
+			showKubeletColumns("nodes")
+		}
+		service.Collector.KubeletStats = needsKubelet("nodes")
+		service.Collector.NodeSelector = *nodeSelector
+		service.Collector.SkipSummary = !*nodesSummary
+		service.Collector.GroupByLabel = *groupByLabel
+		collapseGroups = *collapse
+		report, err := service.Collector.Nodes()
+		if err != nil {
+			return err
+		}
+		if *hideFailing {
+			report.Failing, report.Pending = nil, nil
+		}
+		outputReport(report, report.Errors, func() { outputNodes(report) })
+		return nil
+	}
+
+	pods := newCommand("pods", "Pod usage, state and restarts")
+	containers := pods.Flags.Bool("containers", true, "list restart details for each container that has restarted")
+	podsSummary := pods.Flags.Bool("summary", true, "show cluster totals before the table")
+	podKubelet := pods.Flags.Bool("kubelet-stats", false, "show network, ephemeral storage and memory detail from the kubelet of each node")
+	stream := pods.Flags.Bool("stream", false, "with -o json or csv write pods as each chunk arrives, without the summary, sorting or subtotals")
+	pods.Run = func(service *KubeInfoService) error {
+		if *stream {
+			if outputFormat != formatJSON && outputFormat != formatCSV {
+				return fmt.Errorf("--stream needs -o json or -o csv")
+			}
+			if *podKubelet {
+				return fmt.Errorf("--stream cannot show --kubelet-stats")
+			}
+			return streamPods(service)
+		}
+		if *podKubelet {
+			showKubeletColumns("pods")
+		}
+		service.Collector.KubeletStats = needsKubelet("pods")
+		service.Collector.SkipSummary = !*podsSummary
+		report, err := service.Collector.Pods()
+		if err != nil {
+			return err
+		}
+		if !*containers {
+			for i := range report.Pods {
+				report.Pods[i].Containers = nil
+			}
+		}
+		outputReport(report, report.Errors, func() { outputPods(report) })
+		return nil
+	}
+
+	failing := newCommand("failing", "Pods that are not running and why pending pods are not scheduled")
+	failing.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.Failing()
+		if err != nil {
+			return err
+		}
+		outputReport(report, report.Errors, func() { outputFailingReport(report) })
+		return nil
+	}
+
+	namespaces := newCommand("namespaces", "Pod counts and usage totals per namespace")
+	namespaces.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.Namespaces()
+		if err != nil {
+			return err
+		}
+		outputReport(report, report.Errors, func() { outputNamespaces(report) })
+		return nil
+	}
+
+	events := newCommand("events", "Recent warning events grouped by the object they relate to")
+	events.Run = func(service *KubeInfoService) error {
+		groups, err := service.Collector.Events()
+		if err != nil {
+			return err
+		}
+		outputReport(groups, nil, func() { outputEvents(groups) })
+		return nil
+	}
+
+	storage := newCommand("storage", "Persistent volume claims with kubelet reported usage and unclaimed volumes")
+	storage.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.Storage()
+		if err != nil {
+			return err
+		}
+		outputReport(report, report.Errors, func() { outputStorage(report) })
+		return nil
+	}
+
+	pending := newCommand("pending", "Why pending pods have not been scheduled and which nodes they do not fit on")
+	pending.Run = func(service *KubeInfoService) error {
+		analyses, err := service.Collector.Pending()
+		if err != nil {
+			return err
+		}
+		outputReport(analyses, nil, func() { outputPending(analyses) })
+		return nil
+	}
+
+	hpa := newCommand("hpa", "Horizontal pod autoscalers alongside the CPU utilisation k8s-info measures")
+	hpa.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.HPAs()
+		if err != nil {
+			return err
+		}
+		outputReport(report, report.Errors, func() { outputHPAs(report) })
+		return nil
+	}
+
+	spread := newCommand("spread", "How the ready replicas of Deployments and StatefulSets are spread across nodes and zones")
+	flaggedOnly := spread.Flags.Bool("flagged", false, "only list workloads with a single point of failure")
+	spread.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.Spread()
+		if err != nil {
+			return err
+		}
+		if *flaggedOnly {
+			flagged := report.Workloads[:0]
+			for _, workload := range report.Workloads {
+				if len(workload.Flags) > 0 {
+					flagged = append(flagged, workload)
+				}
+			}
+			report.Workloads = flagged
+		}
+		outputReport(report, report.Errors, func() { outputSpread(report) })
+		return nil
+	}
+
+	risk := newCommand("risk", "Containers ranked by CPU throttling and by memory use against their limits")
+	atRisk := risk.Flags.Bool("at-risk", false, "only list containers with a risk")
+	risk.Run = func(service *KubeInfoService) error {
+		report, err := service.Collector.Risks()
+		if err != nil {
+			return err
+		}
+		if *atRisk {
+			flagged := report.Containers[:0]
+			for _, container := range report.Containers {
+				if len(container.Risks) > 0 {
+					flagged = append(flagged, container)
+				}
+			}
+			report.Containers = flagged
+		}
+		outputReport(report, report.Errors, func() { outputRisks(report) })
+		return nil
+	}
+
+	doctor := newCommand("doctor", "Check the kubeconfig, API server, metrics APIs and RBAC permissions k8s-info needs")
+	doctor.RunOptions = runDoctor
+
+	return []*command{nodes, pods, failing, namespaces, events, storage, pending, hpa, spread, risk, doctor}
+}
+
+func findCommand(commands []*command, name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage(commands []*command, globalFlags *pflag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage: k8s-info [command] [flags]\n\nCommands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.Name, cmd.Short)
+		}
+		fmt.Fprintf(os.Stderr, "\nGlobal Flags:\n%s\n", globalFlags.FlagUsages())
+		fmt.Fprintf(os.Stderr, "Use \"k8s-info <command> --help\" for more information about a command.\n")
+	}
+}
+
+func commandUsage(cmd *command, globalFlags *pflag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "%s\n\nUsage: k8s-info %s [flags]\n\n", cmd.Short, cmd.Name)
+		if cmd.Flags.HasFlags() {
+			fmt.Fprintf(os.Stderr, "Flags:\n%s\n", cmd.Flags.FlagUsages())
+		}
+		if _, ok := viewColumns[cmd.Name]; ok {
+			fmt.Fprintf(os.Stderr, "Columns:\n  %s\n\n", columnNames(cmd.Name))
+		}
+		fmt.Fprintf(os.Stderr, "Global Flags:\n%s", globalFlags.FlagUsages())
+	}
+}
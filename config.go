@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ProjectConfigFile name of the per project config file, looked for in the working directory and its parents
+const ProjectConfigFile = ".k8s-info.yaml"
+
+// threshold warn and critical levels of a value
+type threshold struct {
+	Warning  *float64 `yaml:"warning"`
+	Critical *float64 `yaml:"critical"`
+}
+
+// stateThreshold node states highlighted as warning or critical
+type stateThreshold struct {
+	Warning  []string `yaml:"warning"`
+	Critical []string `yaml:"critical"`
+}
+
+// thresholds levels at which table cells are highlighted, restarts are those in the last hour,
+// disk covers the root, image and ephemeral storage percentages from kubelet stats,
+// throttling and memoryLimit the risk view
+type thresholds struct {
+	CPU         threshold      `yaml:"cpu"`
+	Memory      threshold      `yaml:"memory"`
+	Restarts    threshold      `yaml:"restarts"`
+	Disk        threshold      `yaml:"disk"`
+	Throttling  threshold      `yaml:"throttling"`
+	MemoryLimit threshold      `yaml:"memoryLimit"`
+	NodeState   stateThreshold `yaml:"nodeState"`
+}
+
+// profile settings that can be given in the config file, each replaces the default of the matching flag
+type profile struct {
+	Command   string `yaml:"command"`
+	Context   string `yaml:"context"`
+	Namespace string `yaml:"namespace"`
+	Output    string `yaml:"output"`
+	// Interval watch interval in seconds
+	Interval int `yaml:"interval"`
+	// Columns headers of the columns to show, by view
+	Columns map[string][]string `yaml:"columns"`
+	// Sort header of the column to sort on, by view
+	Sort       map[string]string `yaml:"sort"`
+	Thresholds thresholds        `yaml:"thresholds"`
+}
+
+// config contents of a config file, named profiles are applied over the top level settings
+type config struct {
+	Default  profile            `yaml:",inline"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// userConfigPath location of the user config file
+func userConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "k8s-info", "config.yaml")
+	}
+	return filepath.Join(homeDir(), ".config", "k8s-info", "config.yaml")
+}
+
+// projectConfigPath nearest project config file, empty if there is none
+func projectConfigPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func readConfig(path string) (*config, error) {
+	result := &config{}
+	if path == "" {
+		return result, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return result, nil
+}
+
+// loadConfig read the user config with the project config applied over it, and select the named profile
+func loadConfig(profileName string) (*profile, error) {
+	user, err := readConfig(userConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	project, err := readConfig(projectConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	result := &profile{}
+	result.merge(user.Default)
+	result.merge(project.Default)
+	if profileName != "" {
+		named, ok := project.Profiles[profileName]
+		if !ok {
+			named, ok = user.Profiles[profileName]
+		}
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found in %s or %s", profileName, userConfigPath(), ProjectConfigFile)
+		}
+		result.merge(named)
+	}
+	return result, nil
+}
+
+// merge set the values given in other
+func (p *profile) merge(other profile) {
+	if other.Command != "" {
+		p.Command = other.Command
+	}
+	if other.Context != "" {
+		p.Context = other.Context
+	}
+	if other.Namespace != "" {
+		p.Namespace = other.Namespace
+	}
+	if other.Output != "" {
+		p.Output = other.Output
+	}
+	if other.Interval != 0 {
+		p.Interval = other.Interval
+	}
+	for view, columns := range other.Columns {
+		if p.Columns == nil {
+			p.Columns = map[string][]string{}
+		}
+		p.Columns[view] = columns
+	}
+	for view, column := range other.Sort {
+		if p.Sort == nil {
+			p.Sort = map[string]string{}
+		}
+		p.Sort[view] = column
+	}
+	p.Thresholds.merge(other.Thresholds)
+}
+
+func (t *thresholds) merge(other thresholds) {
+	t.CPU.merge(other.CPU)
+	t.Memory.merge(other.Memory)
+	t.Restarts.merge(other.Restarts)
+	t.Disk.merge(other.Disk)
+	t.Throttling.merge(other.Throttling)
+	t.MemoryLimit.merge(other.MemoryLimit)
+	if other.NodeState.Warning != nil {
+		t.NodeState.Warning = other.NodeState.Warning
+	}
+	if other.NodeState.Critical != nil {
+		t.NodeState.Critical = other.NodeState.Critical
+	}
+}
+
+func (t *threshold) merge(other threshold) {
+	if other.Warning != nil {
+		t.Warning = other.Warning
+	}
+	if other.Critical != nil {
+		t.Critical = other.Critical
+	}
+}
+
+// apply use the profile values for the flags not given on the command line
+func (p *profile) apply(flags *pflag.FlagSet) {
+	values := map[string]string{
+		"context":   p.Context,
+		"namespace": p.Namespace,
+		"output":    p.Output,
+	}
+	if p.Interval != 0 {
+		values["duration"] = strconv.Itoa(p.Interval)
+	}
+	for name, value := range values {
+		if value != "" && !flags.Changed(name) {
+			flags.Set(name, value)
+		}
+	}
+}
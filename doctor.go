@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marc-harry/k8s-info/kubeinfo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// doctorTimeout limit on each call so an unreachable server fails the check rather than hanging
+const doctorTimeout = 10 * time.Second
+
+// doctorMetricsGroups API groups that serve node and pod metrics
+var doctorMetricsGroups = []string{"metrics.k8s.io", "metrics"}
+
+// doctor prints the result of each check and counts the failures
+type doctor struct {
+	failures int
+}
+
+func (d *doctor) section(title string) {
+	fmt.Printf("\n%s\n", title)
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Printf("  [ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(format string, args ...interface{}) {
+	fmt.Printf("  [warn] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(format string, args ...interface{}) {
+	d.failures++
+	fmt.Printf("  [fail] %s\n", fmt.Sprintf(format, args...))
+}
+
+// explain what an API error most likely means
+func explain(err error) string {
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return "the credentials in the kubeconfig were rejected, they may have expired"
+	case apierrors.IsForbidden(err):
+		return "the credentials were accepted but RBAC does not allow this call"
+	case apierrors.IsNotFound(err):
+		return "not found"
+	case apierrors.IsServiceUnavailable(err), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		return "the server did not respond in time"
+	}
+	return err.Error()
+}
+
+func runDoctor(options *globalOptions) error {
+	d := &doctor{}
+	if options.FromFile != "" {
+		d.section("Files")
+		if _, err := kubeinfo.NewFileSource(strings.Split(options.FromFile, ",")...); err != nil {
+			d.fail("%v", err)
+		} else {
+			d.ok("loaded %s, no cluster is contacted when reading from files", options.FromFile)
+		}
+		return d.result()
+	}
+
+	d.section("Kubeconfig")
+	clientConfig := options.clientConfig()
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		d.fail("failed to load %s: %v", kubeconfigFiles(clientConfig), err)
+		fmt.Println("         check --kubeconfig or KUBECONFIG point at a readable kubeconfig file")
+		return d.result()
+	}
+	d.ok("loaded %s", kubeconfigFiles(clientConfig))
+	contextName := raw.CurrentContext
+	if options.Context != "" {
+		contextName = options.Context
+	}
+	context, ok := raw.Contexts[contextName]
+	switch {
+	case ok:
+		cluster, user := context.Cluster, context.AuthInfo
+		if options.Cluster != "" {
+			cluster = options.Cluster
+		}
+		if options.User != "" {
+			user = options.User
+		}
+		d.ok("context %q: cluster %q, user %q", contextName, cluster, user)
+	case options.Server != "":
+		// the connection flags are enough on their own
+		d.ok("no context, connecting to %s from --server", options.Server)
+	default:
+		d.fail("context %q not found, available contexts: %s", contextName, contextNames(raw.Contexts))
+		return d.result()
+	}
+	if options.As != "" || len(options.AsGroups) > 0 {
+		d.ok("impersonating user %q, groups %q", options.As, strings.Join(options.AsGroups, ","))
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		d.fail("invalid client configuration: %v", err)
+		return d.result()
+	}
+	namespace := options.Namespace
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			namespace = DefaultNamespace
+		}
+	}
+	if options.AllNamespaces {
+		namespace = v1.NamespaceAll
+	}
+	options.applyLimits(config)
+	if options.RequestTimeout == 0 {
+		config.Timeout = doctorTimeout
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		d.fail("failed to create client: %v", err)
+		return d.result()
+	}
+
+	d.section("API server")
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		d.fail("%s is not usable: %s", config.Host, explain(err))
+		if !apierrors.IsUnauthorized(err) && !apierrors.IsForbidden(err) {
+			fmt.Println("         check the server address, network or VPN, and any proxy settings")
+		}
+		return d.result()
+	}
+	d.ok("%s reachable, version %s", config.Host, version.GitVersion)
+
+	d.section("Metrics APIs")
+	d.checkMetricsAPIs(client)
+	source, err := options.metricsSource(client)
+	switch {
+	case err != nil:
+		d.fail("%v", err)
+	case options.MetricsSource != metricsHeapster:
+		if _, err := source.GetNodeMetrics("", ""); err != nil {
+			d.fail("kubelet metrics through the node proxy, used for node and pod usage: %s", explain(err))
+		} else {
+			d.ok("kubelet metrics through the node proxy respond")
+		}
+	default:
+		if _, err := source.GetNodeMetrics("", ""); err != nil {
+			d.fail("Heapster service %s/%s, used for node and pod usage: %s", kubeinfo.DefaultHeapsterNamespace, kubeinfo.DefaultHeapsterService, explain(err))
+		} else {
+			d.ok("Heapster service %s/%s responds", kubeinfo.DefaultHeapsterNamespace, kubeinfo.DefaultHeapsterService)
+		}
+	}
+
+	scope := "namespace " + namespace
+	if namespace == v1.NamespaceAll {
+		scope = "all namespaces"
+	}
+	d.section("RBAC permissions (" + scope + ")")
+	for _, check := range kubeinfo.CheckAccess(client.AuthorizationV1(), kubeinfo.RequiredAccess(namespace)) {
+		switch {
+		case check.Err != nil:
+			d.warn("%s: could not be checked: %s", check, explain(check.Err))
+		case check.Allowed:
+			d.ok("%s", check)
+		default:
+			reason := ""
+			if check.Reason != "" {
+				reason = ", " + check.Reason
+			}
+			d.fail("%s: denied, needed for %s%s", check, check.UsedBy, reason)
+		}
+	}
+	return d.result()
+}
+
+// checkMetricsAPIs report which metrics API groups are served and whether their node metrics respond
+func (d *doctor) checkMetricsAPIs(client kubernetes.Interface) {
+	groups, err := client.Discovery().ServerGroups()
+	if err != nil {
+		d.warn("could not list API groups: %s", explain(err))
+		return
+	}
+	served := false
+	for _, group := range groups.Groups {
+		for _, name := range doctorMetricsGroups {
+			if group.Name != name {
+				continue
+			}
+			served = true
+			path := "/apis/" + group.PreferredVersion.GroupVersion + "/nodes"
+			if _, err := client.Discovery().RESTClient().Get().AbsPath(path).DoRaw(); err != nil {
+				d.fail("%s is served but %s fails: %s", group.PreferredVersion.GroupVersion, path, explain(err))
+			} else {
+				d.ok("%s is served and responds", group.PreferredVersion.GroupVersion)
+			}
+		}
+	}
+	if !served {
+		d.warn("no metrics API group is served, metrics-server is not installed")
+	}
+}
+
+func (d *doctor) result() error {
+	fmt.Println()
+	if d.failures > 0 {
+		return fmt.Errorf("%d checks failed", d.failures)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// kubeconfigFiles files the client config is loaded from
+func kubeconfigFiles(clientConfig clientcmd.ClientConfig) string {
+	if explicit := clientConfig.ConfigAccess().GetExplicitFile(); explicit != "" {
+		return explicit
+	}
+	return strings.Join(clientConfig.ConfigAccess().GetLoadingPrecedence(), ", ")
+}
+
+func contextNames(contexts map[string]*clientcmdapi.Context) string {
+	names := []string{}
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,91 @@
+package kubeinfo
+
+import (
+	authorization "k8s.io/api/authorization/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// AccessCheck a call the collector makes and whether the current user is allowed to make it
+type AccessCheck struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string
+	Name        string
+	// UsedBy what needs the call
+	UsedBy  string
+	Allowed bool
+	// Reason explanation from the authorizer, if any
+	Reason string
+	Err    error `json:"-"`
+}
+
+// String the call as kubectl auth can-i arguments
+func (check AccessCheck) String() string {
+	resource := check.Resource
+	if check.Group != "" {
+		resource += "." + check.Group
+	}
+	if check.Subresource != "" {
+		resource += "/" + check.Subresource
+	}
+	if check.Name != "" {
+		resource += "/" + check.Name
+	}
+	result := check.Verb + " " + resource
+	if check.Namespace != "" {
+		result += " -n " + check.Namespace
+	}
+	return result
+}
+
+// RequiredAccess every list and get call made by the collector, namespaced calls are checked in the namespace given
+func RequiredAccess(namespace string) []AccessCheck {
+	return []AccessCheck{
+		{Verb: "list", Resource: "nodes", UsedBy: "nodes view, pod scheduling and summary"},
+		{Verb: "list", Resource: "pods", Namespace: namespace, UsedBy: "every view"},
+		{Verb: "list", Resource: "events", Namespace: namespace, UsedBy: "warnings and pending pod reasons"},
+		{Verb: "list", Resource: "namespaces", UsedBy: "finding the namespaces you can access when pods cannot be listed"},
+		{Verb: "list", Resource: "persistentvolumeclaims", Namespace: namespace, UsedBy: "storage view"},
+		{Verb: "list", Resource: "persistentvolumes", UsedBy: "unclaimed volumes in the storage view"},
+		{Verb: "get", Resource: "nodes", Subresource: "proxy", UsedBy: "kubelet stats for volume usage, the --kubelet-stats columns, the kubelet metrics source and the risk view"},
+		{Verb: "list", Group: "autoscaling", Resource: "horizontalpodautoscalers", Namespace: namespace, UsedBy: "hpa view"},
+		{Verb: "list", Group: "apps", Resource: "deployments", Namespace: namespace, UsedBy: "spread view"},
+		{Verb: "list", Group: "apps", Resource: "statefulsets", Namespace: namespace, UsedBy: "spread view"},
+		{Verb: "get", Group: "apps", Resource: "deployments", Namespace: namespace, UsedBy: "hpa targets"},
+		{Verb: "get", Group: "apps", Resource: "statefulsets", Namespace: namespace, UsedBy: "hpa targets"},
+		{Verb: "get", Group: "apps", Resource: "replicasets", Namespace: namespace, UsedBy: "hpa targets"},
+		{Verb: "get", Resource: "replicationcontrollers", Namespace: namespace, UsedBy: "hpa targets"},
+		{Verb: "list", Group: "policy", Resource: "poddisruptionbudgets", Namespace: namespace, UsedBy: "spread view"},
+		{Verb: "get", Resource: "services", Subresource: "proxy", Namespace: DefaultHeapsterNamespace,
+			Name: DefaultHeapsterScheme + ":" + DefaultHeapsterService + ":" + DefaultHeapsterPort, UsedBy: "Heapster metrics"},
+	}
+}
+
+// CheckAccess ask the API server whether the current user may make each call
+func CheckAccess(reviews authorizationv1.SelfSubjectAccessReviewsGetter, checks []AccessCheck) []AccessCheck {
+	result := []AccessCheck{}
+	for _, check := range checks {
+		review, err := reviews.SelfSubjectAccessReviews().Create(&authorization.SelfSubjectAccessReview{
+			Spec: authorization.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorization.ResourceAttributes{
+					Verb:        check.Verb,
+					Group:       check.Group,
+					Resource:    check.Resource,
+					Subresource: check.Subresource,
+					Namespace:   check.Namespace,
+					Name:        check.Name,
+				},
+			},
+		})
+		if err != nil {
+			check.Err = err
+		} else {
+			check.Allowed = review.Status.Allowed
+			check.Reason = review.Status.Reason
+		}
+		result = append(result, check)
+	}
+	return result
+}
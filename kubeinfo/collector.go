@@ -0,0 +1,277 @@
+// Package kubeinfo collects node, pod and workload statistics from a Kubernetes cluster.
+// Collection is kept separate from rendering, every view returns typed values for the caller to display.
+package kubeinfo
+
+import (
+	"fmt"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// MetricsSource provides node and pod usage
+type MetricsSource interface {
+	GetNodeMetrics(nodeName string, selector string) (*metricsapi.NodeMetricsList, error)
+	GetPodMetrics(namespace string, podName string, allNamespaces bool, selector labels.Selector) (*metricsapi.PodMetricsList, error)
+}
+
+// Options settings for a collector
+type Options struct {
+	// Namespace to collect from, ignored when AllNamespaces is set
+	Namespace     string
+	AllNamespaces bool
+	// LabelSelector restricts the pods collected
+	LabelSelector string
+	// NodeSelector restricts the nodes collected
+	NodeSelector string
+	// Metrics source of usage, NewCollector defaults to Heapster
+	Metrics MetricsSource
+	// DiscoverNamespaces when listing pods in Namespace is forbidden, collect from the namespaces the user may list pods in
+	DiscoverNamespaces bool
+	// CandidateNamespaces namespaces checked by discovery when the user may not list namespaces
+	CandidateNamespaces []string
+	// RefreshTimeout deadline for collecting a view, rows still waiting on metrics are marked as timed out, zero for none
+	RefreshTimeout time.Duration
+	// KubeletStats read the kubelet stats summary of each node for the network, filesystem and memory detail of nodes and pods
+	KubeletStats bool
+	// PageSize items requested in each list call to the API server, zero lists everything at once
+	PageSize int64
+	// StaleAfter age at which a metrics sample is stale, zero never
+	StaleAfter time.Duration
+	// ExcludeStale leave the usage of stale samples out rather than only flagging them
+	ExcludeStale bool
+	// RiskThresholds levels at which the risk view flags a container, the defaults when nil
+	RiskThresholds *RiskThresholds
+}
+
+// Data a report can be missing because RBAC forbids reading it
+const (
+	UnavailableNodes   = "nodes"
+	UnavailableKubelet = "nodes/proxy"
+	UnavailableVolumes = "persistentvolumes"
+)
+
+// Collector gathers cluster statistics
+type Collector struct {
+	Source        Source
+	Metrics       MetricsSource
+	Namespace     string
+	AllNamespaces bool
+	LabelSelector string
+	NodeSelector  string
+	Restarts      RestartHistory
+	// GroupByLabel node label the nodes view is aggregated by
+	GroupByLabel string
+	// SkipSummary leave out the cluster summary of the nodes and pods views
+	SkipSummary bool
+	// DiscoverNamespaces, CandidateNamespaces, RefreshTimeout and KubeletStats as in Options
+	DiscoverNamespaces  bool
+	CandidateNamespaces []string
+	RefreshTimeout      time.Duration
+	KubeletStats        bool
+	Network             NetworkHistory
+	Throttling          ThrottleHistory
+	// StaleAfter and ExcludeStale as in Options
+	StaleAfter   time.Duration
+	ExcludeStale bool
+	// RiskThresholds levels at which the risk view flags a container
+	RiskThresholds RiskThresholds
+	// AccessibleNamespaces discovered namespaces collected from instead of Namespace, nil until discovery has run
+	AccessibleNamespaces []string
+}
+
+// NewCollector get collector for the clientset with the given options
+func NewCollector(client kubernetes.Interface, options Options) *Collector {
+	if options.Metrics == nil {
+		options.Metrics = DefaultHeapsterMetricsClient(client.CoreV1())
+	}
+	source := NewClientSource(client)
+	source.PageSize = options.PageSize
+	return NewSourceCollector(source, options)
+}
+
+// NewSourceCollector get collector reading objects from the source, options.Metrics must be set
+func NewSourceCollector(source Source, options Options) *Collector {
+	namespace := options.Namespace
+	if options.AllNamespaces {
+		namespace = v1.NamespaceAll
+	}
+	riskThresholds := DefaultRiskThresholds()
+	if options.RiskThresholds != nil {
+		riskThresholds = *options.RiskThresholds
+	}
+	return &Collector{
+		Source:        source,
+		Metrics:       options.Metrics,
+		Namespace:     namespace,
+		AllNamespaces: options.AllNamespaces,
+		LabelSelector: options.LabelSelector,
+		NodeSelector:  options.NodeSelector,
+		Restarts:      RestartHistory{},
+
+		DiscoverNamespaces:  options.DiscoverNamespaces,
+		CandidateNamespaces: options.CandidateNamespaces,
+		RefreshTimeout:      options.RefreshTimeout,
+		KubeletStats:        options.KubeletStats,
+		Network:             NetworkHistory{},
+		Throttling:          ThrottleHistory{},
+		StaleAfter:          options.StaleAfter,
+		ExcludeStale:        options.ExcludeStale,
+		RiskThresholds:      riskThresholds,
+	}
+}
+
+// deadline end of a collection started at start, zero when there is no refresh timeout
+func (c *Collector) deadline(start time.Time) time.Time {
+	if c.RefreshTimeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(c.RefreshTimeout)
+}
+
+// expired whether the deadline has passed, a zero deadline never does
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// MetricSample when a metrics sample was taken and the window its usage is averaged over
+type MetricSample struct {
+	Timestamp time.Time
+	Window    time.Duration
+	// Stale older than the collector's StaleAfter when collected
+	Stale bool `json:",omitempty"`
+}
+
+// metricSample freshness of a sample, nil when the source has no timestamp such as kubectl top output
+func (c *Collector) metricSample(timestamp v1.Time, window v1.Duration, now time.Time) *MetricSample {
+	if timestamp.IsZero() {
+		return nil
+	}
+	return &MetricSample{
+		Timestamp: timestamp.Time,
+		Window:    window.Duration,
+		Stale:     c.StaleAfter > 0 && now.Sub(timestamp.Time) > c.StaleAfter,
+	}
+}
+
+// excluded whether the usage of the sample is left out because it is stale
+func (c *Collector) excluded(sample *MetricSample) bool {
+	return c.ExcludeStale && sample != nil && sample.Stale
+}
+
+// staleError non fatal error counting the stale samples of a kind of object
+func (c *Collector) staleError(count int, kind string) error {
+	if c.ExcludeStale {
+		return fmt.Errorf("metrics of %d %s are older than %s and left out", count, kind, c.StaleAfter)
+	}
+	return fmt.Errorf("metrics of %d %s are older than %s, their kubelet may have stopped reporting", count, kind, c.StaleAfter)
+}
+
+// unmeasuredError CPU the metrics source has not measured yet, as on the first refresh of the kubelet source
+func unmeasuredError(count int, kind string) error {
+	return fmt.Errorf("CPU of %d %s is not measured yet and left out of the totals", count, kind)
+}
+
+func (c *Collector) listNodes() ([]typesv1.Node, error) {
+	return c.Source.Nodes(c.NodeSelector)
+}
+
+// listPods pods in the namespace, listing the collector's namespace discovers the accessible namespaces the first time it is forbidden
+func (c *Collector) listPods(namespace string) ([]typesv1.Pod, error) {
+	if namespace != c.Namespace {
+		return c.Source.Pods(namespace, c.LabelSelector)
+	}
+	pods := []typesv1.Pod{}
+	err := c.eachPodPage(func(page []typesv1.Pod) error {
+		pods = append(pods, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods, nil
+}
+
+// eachPodPage call page with each page of the pods in the collector's namespaces as it arrives,
+// discovering the accessible namespaces the first time listing the collector's namespace is forbidden
+func (c *Collector) eachPodPage(page func(pods []typesv1.Pod) error) error {
+	if c.AccessibleNamespaces == nil {
+		err := c.Source.PodPages(c.Namespace, c.LabelSelector, page)
+		if !apierrors.IsForbidden(err) || !c.DiscoverNamespaces {
+			return err
+		}
+		namespaces, discoverErr := c.Source.AccessibleNamespaces(c.CandidateNamespaces)
+		if discoverErr != nil {
+			return fmt.Errorf("%v, and finding the namespaces you can access failed: %v", err, discoverErr)
+		}
+		if len(namespaces) == 0 {
+			return fmt.Errorf("%v, and you may not list pods in any other namespace", err)
+		}
+		c.AccessibleNamespaces = namespaces
+	}
+	for _, namespace := range c.AccessibleNamespaces {
+		if err := c.Source.PodPages(namespace, c.LabelSelector, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespaces the collector reads from, the discovered namespaces once listing pods in Namespace has been forbidden
+func (c *Collector) namespaces() []string {
+	if c.AccessibleNamespaces != nil {
+		return c.AccessibleNamespaces
+	}
+	return []string{c.Namespace}
+}
+
+// listPodMetrics usage of the pods in the collector's namespaces
+func (c *Collector) listPodMetrics(selector labels.Selector) (*metricsapi.PodMetricsList, error) {
+	if c.AccessibleNamespaces == nil {
+		return c.Metrics.GetPodMetrics(c.Namespace, "", c.AllNamespaces, selector)
+	}
+	result := &metricsapi.PodMetricsList{}
+	for _, namespace := range c.AccessibleNamespaces {
+		metrics, err := c.Metrics.GetPodMetrics(namespace, "", false, selector)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, metrics.Items...)
+	}
+	return result, nil
+}
+
+// resourceUsage usage of the resource, nil when the metrics have none such as CPU before the kubelet source has measured a rate
+func resourceUsage(usage typesv1.ResourceList, name typesv1.ResourceName) *resource.Quantity {
+	quantity, ok := usage[name]
+	if !ok {
+		return nil
+	}
+	return &quantity
+}
+
+// addUsage total with the usage of the resource added, nil while none has been
+func addUsage(total *resource.Quantity, usage typesv1.ResourceList, name typesv1.ResourceName) *resource.Quantity {
+	quantity := resourceUsage(usage, name)
+	if quantity == nil {
+		return total
+	}
+	if total == nil {
+		return quantity
+	}
+	total.Add(*quantity)
+	return total
+}
+
+func percentage(first *resource.Quantity, second *resource.Quantity) *inf.Dec {
+	val := new(inf.Dec).QuoRound(first.AsDec(), second.AsDec(), 2, inf.RoundCeil)
+	per := new(inf.Dec).Mul(val, inf.NewDec(100, 0))
+	return per
+}
@@ -0,0 +1,140 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+const (
+	// only warnings seen within this window are treated as recent
+	recentEventWindow = time.Hour
+)
+
+// EventGroup recent warning events collected for a single involved object
+type EventGroup struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reasons   map[string]int32
+	Count     int32
+	LastSeen  time.Time
+	Message   string
+}
+
+func eventKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func eventLastSeen(event typesv1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+func (c *Collector) listWarningEvents(namespace string, selector fields.Selector) ([]typesv1.Event, error) {
+	events, err := c.Source.Events(namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	recent := []typesv1.Event{}
+	for _, event := range events {
+		if time.Since(eventLastSeen(event)) <= recentEventWindow {
+			recent = append(recent, event)
+		}
+	}
+	return recent, nil
+}
+
+// WarningEvents recent warning events in the namespace plus warnings for nodes,
+// which are recorded outside of any workload namespace, keyed by involved object
+func (c *Collector) WarningEvents() (map[string]*EventGroup, error) {
+	warning := fields.OneTermEqualSelector("type", typesv1.EventTypeWarning)
+	events := []typesv1.Event{}
+	for _, namespace := range c.namespaces() {
+		items, err := c.listWarningEvents(namespace, warning)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, items...)
+	}
+	if c.Namespace != v1.NamespaceAll || c.AccessibleNamespaces != nil {
+		// users restricted to their own namespaces are usually not allowed to read node events, go without them
+		nodeEvents, err := c.listWarningEvents(v1.NamespaceAll, fields.AndSelectors(warning, fields.OneTermEqualSelector("involvedObject.kind", "Node")))
+		if err != nil && !apierrors.IsForbidden(err) {
+			return nil, err
+		}
+		events = append(events, nodeEvents...)
+	}
+	return groupEvents(events), nil
+}
+
+func groupEvents(events []typesv1.Event) map[string]*EventGroup {
+	groups := map[string]*EventGroup{}
+	for _, event := range events {
+		obj := event.InvolvedObject
+		key := eventKey(obj.Kind, obj.Namespace, obj.Name)
+		group, ok := groups[key]
+		if !ok {
+			group = &EventGroup{Kind: obj.Kind, Namespace: obj.Namespace, Name: obj.Name, Reasons: map[string]int32{}}
+			groups[key] = group
+		}
+		count := event.Count
+		if count < 1 {
+			count = 1
+		}
+		group.Reasons[event.Reason] += count
+		group.Count += count
+		if lastSeen := eventLastSeen(event); lastSeen.After(group.LastSeen) {
+			group.LastSeen = lastSeen
+			group.Message = event.Message
+		}
+	}
+	return groups
+}
+
+// Summary reasons ordered by count e.g. "BackOff(12), Unhealthy(3)"
+func (group *EventGroup) Summary() string {
+	if group == nil {
+		return ""
+	}
+	reasons := make([]string, 0, len(group.Reasons))
+	for reason := range group.Reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if group.Reasons[reasons[i]] != group.Reasons[reasons[j]] {
+			return group.Reasons[reasons[i]] > group.Reasons[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s(%d)", reason, group.Reasons[reason])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Events recent warning events grouped by involved object, ordered by object name
+func (c *Collector) Events() ([]*EventGroup, error) {
+	groups, err := c.WarningEvents()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*EventGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
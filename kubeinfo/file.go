@@ -0,0 +1,499 @@
+package kubeinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	apps "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta1"
+	typesv1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+	metricsv1alpha1api "k8s.io/metrics/pkg/apis/metrics/v1alpha1"
+)
+
+const (
+	hpaConditionsAnnotation = "autoscaling.alpha.kubernetes.io/conditions"
+)
+
+// FileSource serves objects and metrics loaded from `kubectl get -o json` dumps, for analysis without a cluster.
+// Metrics are read from metrics API list responses e.g. `kubectl get --raw /apis/metrics.k8s.io/v1beta1/pods`
+// or from the output of `kubectl top`.
+// Kubelet stats are not part of such dumps so summaries are always empty.
+type FileSource struct {
+	nodes        []typesv1.Node
+	pods         []typesv1.Pod
+	events       []typesv1.Event
+	claims       []typesv1.PersistentVolumeClaim
+	volumes      []typesv1.PersistentVolume
+	hpas         []autoscaling.HorizontalPodAutoscaler
+	workloads    map[string]labels.Selector
+	deployments  []apps.Deployment
+	statefulSets []apps.StatefulSet
+	budgets      []policy.PodDisruptionBudget
+	nodeMetrics  []metricsv1alpha1api.NodeMetrics
+	podMetrics   []metricsv1alpha1api.PodMetrics
+}
+
+// fileObject fields common to every object and list in a dump
+type fileObject struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// workloadObject fields needed from any workload kind
+type workloadObject struct {
+	Metadata v1.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Selector json.RawMessage `json:"selector"`
+	} `json:"spec"`
+}
+
+// NewFileSource load every object in the given JSON files
+func NewFileSource(paths ...string) (*FileSource, error) {
+	source := &FileSource{workloads: map[string]labels.Selector{}}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := source.load(data); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", path, err)
+		}
+	}
+	return source, nil
+}
+
+func (s *FileSource) load(data []byte) error {
+	if text := strings.TrimSpace(string(data)); strings.HasPrefix(text, "NAME") || strings.HasPrefix(text, "POD") {
+		return s.loadTop(text)
+	}
+	object := fileObject{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(object.Kind, "List") {
+		return s.add(data, object.Kind, object.APIVersion)
+	}
+	// items of typed lists such as NodeList have no kind of their own
+	itemKind := strings.TrimSuffix(object.Kind, "List")
+	for _, item := range object.Items {
+		if err := s.add(item, itemKind, object.APIVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topUnknown value kubectl top prints for a node without metrics
+const topUnknown = "<unknown>"
+
+// loadTop parse the table printed by `kubectl top nodes` or `kubectl top pods`, with or without --containers
+func (s *FileSource) loadTop(text string) error {
+	lines := strings.Split(text, "\n")
+	columns := map[string]int{}
+	for i, name := range strings.Fields(lines[0]) {
+		columns[name] = i
+	}
+	nameColumn, hasName := columns["NAME"]
+	cpuColumn, hasCPU := columns["CPU(cores)"]
+	memoryColumn, hasMemory := columns["MEMORY(bytes)"]
+	if !hasName || !hasCPU || !hasMemory {
+		return fmt.Errorf("unrecognised kubectl top output")
+	}
+	namespaceColumn, hasNamespace := columns["NAMESPACE"]
+	podColumn, hasPod := columns["POD"]
+	// only the nodes output has percentage columns
+	_, isNodes := columns["CPU%"]
+	pods := map[string]int{}
+	for _, line := range lines[1:] {
+		values := strings.Fields(line)
+		// nodes without metrics are printed as <unknown>, like nodes missing from the metrics API they have no usage
+		if len(values) < len(columns) || values[cpuColumn] == topUnknown || values[memoryColumn] == topUnknown {
+			continue
+		}
+		cpu, err := resource.ParseQuantity(values[cpuColumn])
+		if err != nil {
+			return err
+		}
+		memory, err := resource.ParseQuantity(values[memoryColumn])
+		if err != nil {
+			return err
+		}
+		usage := typesv1.ResourceList{typesv1.ResourceCPU: cpu, typesv1.ResourceMemory: memory}
+		if isNodes {
+			s.nodeMetrics = append(s.nodeMetrics, metricsv1alpha1api.NodeMetrics{ObjectMeta: v1.ObjectMeta{Name: values[nameColumn]}, Usage: usage})
+			continue
+		}
+		namespace, podName, container := "", values[nameColumn], values[nameColumn]
+		if hasNamespace {
+			namespace = values[namespaceColumn]
+		}
+		if hasPod {
+			podName = values[podColumn]
+		}
+		key := namespace + "/" + podName
+		if _, ok := pods[key]; !ok {
+			pods[key] = len(s.podMetrics)
+			s.podMetrics = append(s.podMetrics, metricsv1alpha1api.PodMetrics{ObjectMeta: v1.ObjectMeta{Name: podName, Namespace: namespace}})
+		}
+		metric := &s.podMetrics[pods[key]]
+		metric.Containers = append(metric.Containers, metricsv1alpha1api.ContainerMetrics{Name: container, Usage: usage})
+	}
+	return nil
+}
+
+func (s *FileSource) add(data []byte, kind string, apiVersion string) error {
+	object := fileObject{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	if object.Kind != "" {
+		kind, apiVersion = object.Kind, object.APIVersion
+	}
+	var err error
+	switch kind {
+	case "Node":
+		node := typesv1.Node{}
+		err = json.Unmarshal(data, &node)
+		s.nodes = append(s.nodes, node)
+	case "Pod":
+		pod := typesv1.Pod{}
+		err = json.Unmarshal(data, &pod)
+		s.pods = append(s.pods, pod)
+	case "Event":
+		event := typesv1.Event{}
+		err = json.Unmarshal(data, &event)
+		s.events = append(s.events, event)
+	case "PersistentVolumeClaim":
+		claim := typesv1.PersistentVolumeClaim{}
+		err = json.Unmarshal(data, &claim)
+		s.claims = append(s.claims, claim)
+	case "PersistentVolume":
+		volume := typesv1.PersistentVolume{}
+		err = json.Unmarshal(data, &volume)
+		s.volumes = append(s.volumes, volume)
+	case "HorizontalPodAutoscaler":
+		hpa := autoscaling.HorizontalPodAutoscaler{}
+		if apiVersion == autoscalingv1.SchemeGroupVersion.String() {
+			hpa, err = convertHPA(data)
+		} else {
+			err = json.Unmarshal(data, &hpa)
+		}
+		s.hpas = append(s.hpas, hpa)
+	case "Deployment", "StatefulSet", "ReplicaSet", "ReplicationController":
+		if err = s.addWorkload(data, kind); err != nil {
+			return err
+		}
+		// older API versions of both kinds share the fields read from apps/v1
+		if kind == "Deployment" {
+			deployment := apps.Deployment{}
+			err = json.Unmarshal(data, &deployment)
+			s.deployments = append(s.deployments, deployment)
+		} else if kind == "StatefulSet" {
+			statefulSet := apps.StatefulSet{}
+			err = json.Unmarshal(data, &statefulSet)
+			s.statefulSets = append(s.statefulSets, statefulSet)
+		}
+	case "PodDisruptionBudget":
+		budget := policy.PodDisruptionBudget{}
+		err = json.Unmarshal(data, &budget)
+		s.budgets = append(s.budgets, budget)
+	case "NodeMetrics":
+		metric := metricsv1alpha1api.NodeMetrics{}
+		err = json.Unmarshal(data, &metric)
+		s.nodeMetrics = append(s.nodeMetrics, metric)
+	case "PodMetrics":
+		metric := metricsv1alpha1api.PodMetrics{}
+		err = json.Unmarshal(data, &metric)
+		s.podMetrics = append(s.podMetrics, metric)
+	}
+	return err
+}
+
+func (s *FileSource) addWorkload(data []byte, kind string) error {
+	workload := workloadObject{}
+	if err := json.Unmarshal(data, &workload); err != nil {
+		return err
+	}
+	var selector labels.Selector
+	if kind == "ReplicationController" {
+		set := labels.Set{}
+		if err := json.Unmarshal(workload.Spec.Selector, &set); err != nil {
+			return err
+		}
+		selector = labels.SelectorFromSet(set)
+	} else {
+		labelSelector := &v1.LabelSelector{}
+		if err := json.Unmarshal(workload.Spec.Selector, labelSelector); err != nil {
+			return err
+		}
+		var err error
+		if selector, err = v1.LabelSelectorAsSelector(labelSelector); err != nil {
+			return err
+		}
+	}
+	s.workloads[kind+"/"+workload.Metadata.Namespace+"/"+workload.Metadata.Name] = selector
+	return nil
+}
+
+// convertHPA autoscaling/v1 is what kubectl dumps by default, the v2beta1 conditions are kept in an annotation
+func convertHPA(data []byte) (autoscaling.HorizontalPodAutoscaler, error) {
+	original := autoscalingv1.HorizontalPodAutoscaler{}
+	if err := json.Unmarshal(data, &original); err != nil {
+		return autoscaling.HorizontalPodAutoscaler{}, err
+	}
+	hpa := autoscaling.HorizontalPodAutoscaler{
+		ObjectMeta: original.ObjectMeta,
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+				Kind:       original.Spec.ScaleTargetRef.Kind,
+				Name:       original.Spec.ScaleTargetRef.Name,
+				APIVersion: original.Spec.ScaleTargetRef.APIVersion,
+			},
+			MinReplicas: original.Spec.MinReplicas,
+			MaxReplicas: original.Spec.MaxReplicas,
+		},
+		Status: autoscaling.HorizontalPodAutoscalerStatus{
+			CurrentReplicas: original.Status.CurrentReplicas,
+			DesiredReplicas: original.Status.DesiredReplicas,
+		},
+	}
+	if original.Spec.TargetCPUUtilizationPercentage != nil {
+		hpa.Spec.Metrics = []autoscaling.MetricSpec{{
+			Type:     autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{Name: typesv1.ResourceCPU, TargetAverageUtilization: original.Spec.TargetCPUUtilizationPercentage},
+		}}
+	}
+	if original.Status.CurrentCPUUtilizationPercentage != nil {
+		hpa.Status.CurrentMetrics = []autoscaling.MetricStatus{{
+			Type:     autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricStatus{Name: typesv1.ResourceCPU, CurrentAverageUtilization: original.Status.CurrentCPUUtilizationPercentage},
+		}}
+	}
+	if conditions, ok := original.Annotations[hpaConditionsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(conditions), &hpa.Status.Conditions); err != nil {
+			return hpa, err
+		}
+	}
+	return hpa, nil
+}
+
+func inNamespace(namespace string, objectNamespace string) bool {
+	return namespace == v1.NamespaceAll || namespace == objectNamespace
+}
+
+// Nodes loaded nodes matching the label selector
+func (s *FileSource) Nodes(selector string) ([]typesv1.Node, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []typesv1.Node{}
+	for _, node := range s.nodes {
+		if parsed.Matches(labels.Set(node.Labels)) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// Pods loaded pods in the namespace matching the label selector
+func (s *FileSource) Pods(namespace string, selector string) ([]typesv1.Pod, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := []typesv1.Pod{}
+	for _, pod := range s.pods {
+		if inNamespace(namespace, pod.Namespace) && parsed.Matches(labels.Set(pod.Labels)) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// PodPages loaded pods in the namespace matching the label selector as a single page
+func (s *FileSource) PodPages(namespace string, selector string, page func(pods []typesv1.Pod) error) error {
+	pods, err := s.Pods(namespace, selector)
+	if err != nil {
+		return err
+	}
+	return page(pods)
+}
+
+// Events loaded events in the namespace matching the field selector
+func (s *FileSource) Events(namespace string, selector fields.Selector) ([]typesv1.Event, error) {
+	events := []typesv1.Event{}
+	for _, event := range s.events {
+		set := fields.Set{
+			"type":                     event.Type,
+			"reason":                   event.Reason,
+			"involvedObject.kind":      event.InvolvedObject.Kind,
+			"involvedObject.name":      event.InvolvedObject.Name,
+			"involvedObject.namespace": event.InvolvedObject.Namespace,
+			"metadata.namespace":       event.Namespace,
+		}
+		if inNamespace(namespace, event.Namespace) && selector.Matches(set) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// PersistentVolumeClaims loaded claims in the namespace
+func (s *FileSource) PersistentVolumeClaims(namespace string) ([]typesv1.PersistentVolumeClaim, error) {
+	claims := []typesv1.PersistentVolumeClaim{}
+	for _, claim := range s.claims {
+		if inNamespace(namespace, claim.Namespace) {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+// PersistentVolumes every loaded persistent volume
+func (s *FileSource) PersistentVolumes() ([]typesv1.PersistentVolume, error) {
+	return s.volumes, nil
+}
+
+// HorizontalPodAutoscalers loaded autoscalers in the namespace
+func (s *FileSource) HorizontalPodAutoscalers(namespace string) ([]autoscaling.HorizontalPodAutoscaler, error) {
+	hpas := []autoscaling.HorizontalPodAutoscaler{}
+	for _, hpa := range s.hpas {
+		if inNamespace(namespace, hpa.Namespace) {
+			hpas = append(hpas, hpa)
+		}
+	}
+	return hpas, nil
+}
+
+// Deployments loaded deployments in the namespace
+func (s *FileSource) Deployments(namespace string) ([]apps.Deployment, error) {
+	deployments := []apps.Deployment{}
+	for _, deployment := range s.deployments {
+		if inNamespace(namespace, deployment.Namespace) {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments, nil
+}
+
+// StatefulSets loaded stateful sets in the namespace
+func (s *FileSource) StatefulSets(namespace string) ([]apps.StatefulSet, error) {
+	statefulSets := []apps.StatefulSet{}
+	for _, statefulSet := range s.statefulSets {
+		if inNamespace(namespace, statefulSet.Namespace) {
+			statefulSets = append(statefulSets, statefulSet)
+		}
+	}
+	return statefulSets, nil
+}
+
+// PodDisruptionBudgets loaded disruption budgets in the namespace
+func (s *FileSource) PodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error) {
+	budgets := []policy.PodDisruptionBudget{}
+	for _, budget := range s.budgets {
+		if inNamespace(namespace, budget.Namespace) {
+			budgets = append(budgets, budget)
+		}
+	}
+	return budgets, nil
+}
+
+// WorkloadSelector label selector of a loaded workload
+func (s *FileSource) WorkloadSelector(namespace string, kind string, name string) (labels.Selector, error) {
+	selector, ok := s.workloads[kind+"/"+namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s not found", kind, namespace, name)
+	}
+	return selector, nil
+}
+
+// KubeletSummary always empty as kubelet stats are not part of a dump
+func (s *FileSource) KubeletSummary(nodeName string) (*KubeletSummary, error) {
+	return &KubeletSummary{}, nil
+}
+
+// KubeletCadvisor always empty as kubelet metrics are not part of a dump
+func (s *FileSource) KubeletCadvisor(nodeName string) ([]byte, error) {
+	return nil, nil
+}
+
+// AccessibleNamespaces namespaces of the pods read, nothing in a file is forbidden
+func (s *FileSource) AccessibleNamespaces(candidates []string) ([]string, error) {
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, pod := range s.pods {
+		if !seen[pod.Namespace] {
+			seen[pod.Namespace] = true
+			namespaces = append(namespaces, pod.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// GetNodeMetrics loaded metrics for the node
+func (s *FileSource) GetNodeMetrics(nodeName string, selector string) (*metricsapi.NodeMetricsList, error) {
+	versionedMetrics := metricsv1alpha1api.NodeMetricsList{}
+	for _, metric := range s.nodeMetrics {
+		if nodeName == "" || metric.Name == nodeName {
+			versionedMetrics.Items = append(versionedMetrics.Items, metric)
+		}
+	}
+	if nodeName != "" && len(versionedMetrics.Items) == 0 {
+		return nil, fmt.Errorf("no metrics loaded for node %s", nodeName)
+	}
+	metrics := &metricsapi.NodeMetricsList{}
+	err := metricsv1alpha1api.Convert_v1alpha1_NodeMetricsList_To_metrics_NodeMetricsList(&versionedMetrics, metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// podLabels labels of the loaded pod the metrics belong to, metrics APIs do not always copy them
+func (s *FileSource) podLabels(metric metricsv1alpha1api.PodMetrics) labels.Set {
+	for _, pod := range s.pods {
+		if (metric.Namespace == "" || pod.Namespace == metric.Namespace) && pod.Name == metric.Name {
+			return labels.Set(pod.Labels)
+		}
+	}
+	return labels.Set(metric.Labels)
+}
+
+// GetPodMetrics loaded metrics for the pod, or every pod in the namespace matching the selector when podName is empty
+func (s *FileSource) GetPodMetrics(namespace string, podName string, allNamespaces bool, selector labels.Selector) (*metricsapi.PodMetricsList, error) {
+	if allNamespaces {
+		namespace, podName = v1.NamespaceAll, ""
+	}
+	versionedMetrics := metricsv1alpha1api.PodMetricsList{}
+	for _, metric := range s.podMetrics {
+		// kubectl top output without a namespace column matches any namespace
+		if (metric.Namespace != "" && !inNamespace(namespace, metric.Namespace)) || !selector.Matches(s.podLabels(metric)) {
+			continue
+		}
+		if podName == "" || metric.Name == podName {
+			versionedMetrics.Items = append(versionedMetrics.Items, metric)
+		}
+	}
+	if podName != "" && len(versionedMetrics.Items) == 0 {
+		return nil, fmt.Errorf("no metrics loaded for pod %s", podName)
+	}
+	metrics := &metricsapi.PodMetricsList{}
+	err := metricsv1alpha1api.Convert_v1alpha1_PodMetricsList_To_metrics_PodMetricsList(&versionedMetrics, metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
@@ -0,0 +1,327 @@
+package kubeinfo
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// newFileCollector collector reading the named files under testdata
+func newFileCollector(t *testing.T, namespace string, files ...string) *Collector {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, filepath.Join("testdata", file))
+	}
+	source, err := NewFileSource(paths...)
+	if err != nil {
+		t.Fatalf("failed to load %v: %v", files, err)
+	}
+	return NewSourceCollector(source, Options{
+		Namespace:     namespace,
+		AllNamespaces: namespace == v1.NamespaceAll,
+		Metrics:       source,
+	})
+}
+
+// restrictedSource file source of a user who may only list the pods and claims of one namespace, every namespace when empty
+type restrictedSource struct {
+	*FileSource
+	namespace string
+}
+
+func (s restrictedSource) Pods(namespace string, selector string) ([]typesv1.Pod, error) {
+	if namespace != s.namespace {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("cannot list pods"))
+	}
+	return s.FileSource.Pods(namespace, selector)
+}
+
+func (s restrictedSource) PersistentVolumeClaims(namespace string) ([]typesv1.PersistentVolumeClaim, error) {
+	if namespace != s.namespace {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "persistentvolumeclaims"}, "", errors.New("cannot list claims"))
+	}
+	return s.FileSource.PersistentVolumeClaims(namespace)
+}
+
+// failingMetrics metrics source without a metrics API to read from
+type failingMetrics struct{}
+
+func (failingMetrics) GetNodeMetrics(nodeName string, selector string) (*metricsapi.NodeMetricsList, error) {
+	return nil, errors.New("the server could not find the requested resource")
+}
+
+func (failingMetrics) GetPodMetrics(namespace string, podName string, allNamespaces bool, selector labels.Selector) (*metricsapi.PodMetricsList, error) {
+	return nil, errors.New("the server could not find the requested resource")
+}
+
+// quantityString quantity as the tables show it, empty when unknown
+func quantityString(quantity *resource.Quantity) string {
+	if quantity == nil {
+		return ""
+	}
+	return quantity.String()
+}
+
+func TestFileSourceNodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		failed bool
+		want   map[string][2]string
+		errors int
+	}{
+		{
+			name:  "metrics API dump",
+			files: []string{"cluster.json", "node-metrics.json"},
+			want:  map[string][2]string{"n1": {"500m", "1Gi"}, "n2": {"1", "2Gi"}},
+		},
+		{
+			name:   "kubectl top with a node without metrics",
+			files:  []string{"cluster.json", "top-nodes.txt"},
+			want:   map[string][2]string{"n1": {"250m", "1Gi"}},
+			errors: 1,
+		},
+		{
+			name:   "no metrics",
+			files:  []string{"cluster.json"},
+			want:   map[string][2]string{},
+			errors: 2,
+		},
+		{
+			name:   "metrics API failing",
+			files:  []string{"cluster.json"},
+			failed: true,
+			want:   map[string][2]string{"n1": {"", ""}, "n2": {"", ""}},
+			errors: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collector := newFileCollector(t, "default", test.files...)
+			collector.SkipSummary = true
+			if test.failed {
+				collector.Metrics = failingMetrics{}
+			}
+			report, err := collector.Nodes()
+			if err != nil {
+				t.Fatalf("Nodes() error = %v", err)
+			}
+			got := map[string][2]string{}
+			for _, node := range report.Nodes {
+				got[node.Name] = [2]string{quantityString(node.CPUUsage), quantityString(node.MemoryUsage)}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Nodes() usage = %v, want %v", got, test.want)
+			}
+			if len(report.Errors) != test.errors {
+				t.Errorf("Nodes() errors = %v, want %d", report.Errors, test.errors)
+			}
+		})
+	}
+}
+
+func TestFileSourcePods(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		files     []string
+		want      map[string][2]string
+	}{
+		{
+			name:      "metrics API dump",
+			namespace: "default",
+			files:     []string{"cluster.json", "pod-metrics.json"},
+			want:      map[string][2]string{"default/web-1": {"250m", "128Mi"}, "default/creating": {"", ""}, "default/big": {"", ""}},
+		},
+		{
+			name:      "kubectl top in all namespaces",
+			namespace: v1.NamespaceAll,
+			files:     []string{"cluster.json", "top-pods.txt"},
+			want: map[string][2]string{
+				"default/web-1":    {"300m", "200Mi"},
+				"default/creating": {"", ""},
+				"default/big":      {"", ""},
+				"team/worker":      {"50m", "32Mi"},
+			},
+		},
+		{
+			name:      "another namespace",
+			namespace: "team",
+			files:     []string{"cluster.json", "pod-metrics.json"},
+			want:      map[string][2]string{"team/worker": {"100m", "64Mi"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collector := newFileCollector(t, test.namespace, test.files...)
+			collector.SkipSummary = true
+			report, err := collector.Pods()
+			if err != nil {
+				t.Fatalf("Pods() error = %v", err)
+			}
+			got := map[string][2]string{}
+			for _, pod := range report.Pods {
+				got[pod.Namespace+"/"+pod.Name] = [2]string{quantityString(pod.CPUUsage), quantityString(pod.MemoryUsage)}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Pods() usage = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFileSourceFailing(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		want      []string
+	}{
+		{name: "pending pods", namespace: "default", want: []string{"big", "creating"}},
+		{name: "nothing failing", namespace: "team", want: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := newFileCollector(t, test.namespace, "cluster.json").Failing()
+			if err != nil {
+				t.Fatalf("Failing() error = %v", err)
+			}
+			got := []string{}
+			for _, pod := range report.Failing {
+				got = append(got, pod.Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Failing() pods = %v, want %v", got, test.want)
+			}
+			if len(report.Pending) != len(test.want) {
+				t.Errorf("Failing() pending = %d pods, want %d", len(report.Pending), len(test.want))
+			}
+		})
+	}
+}
+
+func TestFileSourcePending(t *testing.T) {
+	tests := []struct {
+		pod     string
+		node    string
+		reason  string
+		summary string
+	}{
+		// requests of a pod already on a node are held there, so it is not fitted against the nodes again
+		{pod: "creating", node: "n1", reason: "ContainerCreating", summary: "scheduled on n1"},
+		{pod: "big", reason: "Unschedulable", summary: "0/2 nodes fit; insufficient cpu(2)"},
+	}
+	pending, err := newFileCollector(t, "default", "cluster.json").Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+	analyses := map[string]*PendingPod{}
+	for _, analysis := range pending {
+		analyses[analysis.Name] = analysis
+	}
+	if len(analyses) != len(tests) {
+		t.Errorf("Pending() = %d pods, want %d", len(analyses), len(tests))
+	}
+	for _, test := range tests {
+		t.Run(test.pod, func(t *testing.T) {
+			analysis, ok := analyses[test.pod]
+			if !ok {
+				t.Fatalf("Pending() has no analysis of %s", test.pod)
+			}
+			if analysis.Node != test.node || analysis.Reason != test.reason {
+				t.Errorf("Pending() node, reason = %q, %q, want %q, %q", analysis.Node, analysis.Reason, test.node, test.reason)
+			}
+			if summary := analysis.NodeSummary(); summary != test.summary {
+				t.Errorf("NodeSummary() = %q, want %q", summary, test.summary)
+			}
+		})
+	}
+}
+
+func TestFileSourceSummary(t *testing.T) {
+	// the namespace collected does not narrow the summary down, it covers every pod
+	for _, namespace := range []string{"default", "team", v1.NamespaceAll} {
+		t.Run(namespace, func(t *testing.T) {
+			summary, err := newFileCollector(t, namespace, "cluster.json", "node-metrics.json", "pod-metrics.json").Summary()
+			if err != nil {
+				t.Fatalf("Summary() error = %v", err)
+			}
+			if summary.PodScope != "" || summary.Pods != 4 {
+				t.Errorf("Summary() pods = %d in %q, want 4 in every namespace", summary.Pods, summary.PodScope)
+			}
+			// big is not scheduled and worker has no requests
+			got := [4]string{quantityString(summary.CPUUsage), quantityString(summary.CPUAllocatable), quantityString(summary.PodCPUUsage), quantityString(summary.CPURequests)}
+			want := [4]string{"1500m", "4", "350m", "1500m"}
+			if got != want {
+				t.Errorf("Summary() cpu usage, allocatable, pod usage, requests = %v, want %v", got, want)
+			}
+			if len(summary.Errors) != 0 {
+				t.Errorf("Summary() errors = %v", summary.Errors)
+			}
+		})
+	}
+}
+
+func TestFileSourceSummaryUnmeasured(t *testing.T) {
+	// web-1 has no CPU yet, as on the first refresh of the kubelet source
+	summary, err := newFileCollector(t, "default", "cluster.json", "node-metrics.json", "pod-metrics-unmeasured.json").Summary()
+	if err != nil {
+		t.Fatalf("Summary() error = %v", err)
+	}
+	if cpu := quantityString(summary.PodCPUUsage); cpu != "100m" || summary.CPURequestsPercent != nil {
+		t.Errorf("Summary() pod cpu = %q (%v%%), want 100m without a percentage", cpu, summary.CPURequestsPercent)
+	}
+	if memory := quantityString(summary.PodMemoryUsage); memory != "192Mi" {
+		t.Errorf("Summary() pod memory = %q, want 192Mi", memory)
+	}
+	if len(summary.Errors) != 1 {
+		t.Errorf("Summary() errors = %v, want the pod without CPU", summary.Errors)
+	}
+}
+
+func TestFileSourcePendingForbidden(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		summary   string
+	}{
+		// every pod is needed for what the nodes already hold
+		{name: "pods forbidden", namespace: "default", summary: "unknown, not allowed to list every pod"},
+		// every pod but no claims in default, the nodes are still fitted
+		{name: "claims forbidden", namespace: v1.NamespaceAll, summary: "0/2 nodes fit; insufficient cpu(2)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			collector := newFileCollector(t, "default")
+			source, err := NewFileSource(filepath.Join("testdata", "cluster.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector.Source = restrictedSource{FileSource: source, namespace: test.namespace}
+			pending, err := collector.Pending()
+			if err != nil {
+				t.Fatalf("Pending() error = %v", err)
+			}
+			for _, analysis := range pending {
+				if analysis.Name != "big" {
+					continue
+				}
+				if analysis.Reason != "Unschedulable" || analysis.NodeSummary() != test.summary {
+					t.Errorf("Pending() big = %q, %q, want %q, %q", analysis.Reason, analysis.NodeSummary(), "Unschedulable", test.summary)
+				}
+				return
+			}
+			t.Errorf("Pending() = %v, want an analysis of big", pending)
+		})
+	}
+}
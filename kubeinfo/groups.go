@@ -0,0 +1,70 @@
+package kubeinfo
+
+import (
+	"sort"
+
+	inf "gopkg.in/inf.v0"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// NoLabelValue group of the nodes that do not have the label
+const NoLabelValue = "<none>"
+
+// NodeGroup totals of the nodes sharing a label value
+type NodeGroup struct {
+	Label             string
+	Value             string
+	NodeCount         int
+	CPUUsage          *resource.Quantity
+	CPUAllocatable    *resource.Quantity
+	CPUPercent        *inf.Dec
+	MemoryUsage       *resource.Quantity
+	MemoryAllocatable *resource.Quantity
+	MemoryPercent     *inf.Dec
+	PodCount          int
+	// Members names of the nodes in the group
+	Members []string
+}
+
+// GroupNodes aggregate the nodes by the value of the label, groups are sorted by value
+func GroupNodes(nodes []NodeStats, label string) []NodeGroup {
+	groups := map[string]*NodeGroup{}
+	for _, node := range nodes {
+		value, ok := node.Labels[label]
+		if !ok {
+			value = NoLabelValue
+		}
+		group, ok := groups[value]
+		if !ok {
+			group = &NodeGroup{
+				Label:             label,
+				Value:             value,
+				CPUUsage:          &resource.Quantity{},
+				CPUAllocatable:    &resource.Quantity{},
+				MemoryUsage:       &resource.Quantity{},
+				MemoryAllocatable: &resource.Quantity{},
+			}
+			groups[value] = group
+		}
+		group.NodeCount++
+		// the usage of timed out nodes and excluded stale samples is unknown, leaving them out of the totals keeps the percentages true
+		if node.CPUUsage != nil {
+			group.CPUUsage.Add(*node.CPUUsage)
+			group.CPUAllocatable.Add(*node.CPUAllocatable)
+		}
+		if node.MemoryUsage != nil {
+			group.MemoryUsage.Add(*node.MemoryUsage)
+			group.MemoryAllocatable.Add(*node.MemoryAllocatable)
+		}
+		group.PodCount += node.PodCount
+		group.Members = append(group.Members, node.Name)
+	}
+	result := []NodeGroup{}
+	for _, group := range groups {
+		group.CPUPercent = optionalPercentage(group.CPUUsage, group.CPUAllocatable)
+		group.MemoryPercent = optionalPercentage(group.MemoryUsage, group.MemoryAllocatable)
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Value < result[j].Value })
+	return result
+}
@@ -0,0 +1,146 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+
+	inf "gopkg.in/inf.v0"
+	autoscaling "k8s.io/api/autoscaling/v2beta1"
+	typesv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// HPAStats state of a horizontal pod autoscaler
+type HPAStats struct {
+	Name            string
+	Namespace       string
+	Target          autoscaling.CrossVersionObjectReference
+	MinReplicas     int32
+	MaxReplicas     int32
+	CurrentReplicas int32
+	DesiredReplicas int32
+	// CurrentCPU and TargetCPU utilisation as reported by the HPA, nil when not using CPU
+	CurrentCPU *int32
+	TargetCPU  *int32
+	// MeasuredCPU utilisation of the target pods against their requests as measured by k8s-info
+	MeasuredCPU *inf.Dec
+	Conditions  []autoscaling.HorizontalPodAutoscalerCondition
+	Flags       []string
+}
+
+// HPAReport result of collecting the hpa view
+type HPAReport struct {
+	HPAs []HPAStats
+	// Errors non fatal failures, affected values are left out
+	Errors []error `json:"-"`
+}
+
+// measuredCPU CPU usage of the target pods as a percentage of their requests
+func (c *Collector) measuredCPU(namespace string, selector labels.Selector) (*inf.Dec, error) {
+	pods, err := c.Source.Pods(namespace, selector.String())
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := c.Metrics.GetPodMetrics(namespace, "", false, selector)
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]*resource.Quantity{}
+	for _, metric := range metrics.Items {
+		var podUsage *resource.Quantity
+		for _, container := range metric.Containers {
+			podUsage = addUsage(podUsage, container.Usage, typesv1.ResourceCPU)
+		}
+		usage[metric.Name] = podUsage
+	}
+	totalUsage, totalRequests := resource.Quantity{}, resource.Quantity{}
+	unmeasured := 0
+	for _, pod := range pods {
+		podUsage, ok := usage[pod.Name]
+		if !ok || pod.Status.Phase != typesv1.PodRunning {
+			continue
+		}
+		// a pod without CPU yet would count its requests against no usage
+		if podUsage == nil {
+			unmeasured++
+			continue
+		}
+		requests, _ := podRequests(pod)
+		totalUsage.Add(*podUsage)
+		totalRequests.Add(*requests)
+	}
+	if unmeasured > 0 {
+		err = unmeasuredError(unmeasured, "pods")
+	}
+	if totalRequests.IsZero() {
+		return nil, err
+	}
+	return percentage(&totalUsage, &totalRequests), err
+}
+
+// hpaFlags problems worth drawing attention to
+func hpaFlags(hpa autoscaling.HorizontalPodAutoscaler) []string {
+	flags := []string{}
+	if hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+		flags = append(flags, "At max replicas")
+	}
+	for _, condition := range hpa.Status.Conditions {
+		if condition.Type == autoscaling.ScalingActive && condition.Status == typesv1.ConditionFalse {
+			flags = append(flags, "Unable to compute metrics")
+		}
+		if condition.Type == autoscaling.AbleToScale && condition.Status == typesv1.ConditionFalse {
+			flags = append(flags, "Unable to scale")
+		}
+	}
+	return flags
+}
+
+// HPAs collect every horizontal pod autoscaler in the namespace
+func (c *Collector) HPAs() (*HPAReport, error) {
+	hpas := []autoscaling.HorizontalPodAutoscaler{}
+	for _, namespace := range c.namespaces() {
+		items, err := c.Source.HorizontalPodAutoscalers(namespace)
+		if err != nil {
+			return nil, err
+		}
+		hpas = append(hpas, items...)
+	}
+	report := &HPAReport{}
+	for _, hpa := range hpas {
+		stats := HPAStats{
+			Name:            hpa.Name,
+			Namespace:       hpa.Namespace,
+			Target:          hpa.Spec.ScaleTargetRef,
+			MinReplicas:     1,
+			MaxReplicas:     hpa.Spec.MaxReplicas,
+			CurrentReplicas: hpa.Status.CurrentReplicas,
+			DesiredReplicas: hpa.Status.DesiredReplicas,
+			Conditions:      hpa.Status.Conditions,
+			Flags:           hpaFlags(hpa),
+		}
+		if hpa.Spec.MinReplicas != nil {
+			stats.MinReplicas = *hpa.Spec.MinReplicas
+		}
+		for _, metric := range hpa.Spec.Metrics {
+			if metric.Resource != nil && metric.Resource.Name == typesv1.ResourceCPU {
+				stats.TargetCPU = metric.Resource.TargetAverageUtilization
+			}
+		}
+		for _, metric := range hpa.Status.CurrentMetrics {
+			if metric.Resource != nil && metric.Resource.Name == typesv1.ResourceCPU {
+				stats.CurrentCPU = metric.Resource.CurrentAverageUtilization
+			}
+		}
+		selector, err := c.Source.WorkloadSelector(hpa.Namespace, hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name)
+		if err == nil {
+			stats.MeasuredCPU, err = c.measuredCPU(hpa.Namespace, selector)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to measure CPU for HPA %s: %v", hpa.Name, err))
+		}
+		report.HPAs = append(report.HPAs, stats)
+	}
+	sort.Slice(report.HPAs, func(i, j int) bool { return report.HPAs[i].Name < report.HPAs[j].Name })
+	return report, nil
+}
@@ -0,0 +1,118 @@
+package kubeinfo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// KubeletSummary subset of the kubelet /stats/summary response
+type KubeletSummary struct {
+	Node KubeletNodeStats  `json:"node"`
+	Pods []KubeletPodStats `json:"pods"`
+}
+
+// KubeletNodeStats node level stats of a kubelet summary
+type KubeletNodeStats struct {
+	NodeName string               `json:"nodeName"`
+	CPU      *KubeletCPUStats     `json:"cpu,omitempty"`
+	Memory   *KubeletMemoryStats  `json:"memory,omitempty"`
+	Network  *KubeletNetworkStats `json:"network,omitempty"`
+	Fs       *KubeletFsStats      `json:"fs,omitempty"`
+	Runtime  *KubeletRuntimeStats `json:"runtime,omitempty"`
+}
+
+// KubeletCPUStats CPU usage sampled at Time, UsageNanoCores is the kubelet's own rate over its last housekeeping interval
+type KubeletCPUStats struct {
+	Time                 metav1.Time `json:"time"`
+	UsageNanoCores       *uint64     `json:"usageNanoCores,omitempty"`
+	UsageCoreNanoSeconds *uint64     `json:"usageCoreNanoSeconds,omitempty"`
+}
+
+// KubeletMemoryStats memory usage, the working set is what the kubelet evicts on
+type KubeletMemoryStats struct {
+	WorkingSetBytes *uint64 `json:"workingSetBytes,omitempty"`
+	RSSBytes        *uint64 `json:"rssBytes,omitempty"`
+}
+
+// KubeletNetworkStats bytes received and sent since the interface was created, sampled at Time
+type KubeletNetworkStats struct {
+	Time    metav1.Time `json:"time"`
+	RxBytes *uint64     `json:"rxBytes,omitempty"`
+	TxBytes *uint64     `json:"txBytes,omitempty"`
+}
+
+// KubeletRuntimeStats container runtime stats of a node
+type KubeletRuntimeStats struct {
+	ImageFs *KubeletFsStats `json:"imageFs,omitempty"`
+}
+
+// KubeletContainerStats container level stats of a kubelet summary
+type KubeletContainerStats struct {
+	Name   string              `json:"name"`
+	CPU    *KubeletCPUStats    `json:"cpu,omitempty"`
+	Memory *KubeletMemoryStats `json:"memory,omitempty"`
+}
+
+// KubeletPodReference reference to a pod or claim in a kubelet summary
+type KubeletPodReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// KubeletPodStats pod level stats of a kubelet summary
+type KubeletPodStats struct {
+	PodRef      KubeletPodReference     `json:"podRef"`
+	Containers  []KubeletContainerStats `json:"containers,omitempty"`
+	Network     *KubeletNetworkStats    `json:"network,omitempty"`
+	VolumeStats []KubeletVolumeStats    `json:"volume,omitempty"`
+	// EphemeralStorage container writable layers, logs and emptyDir volumes, counted against ephemeral-storage limits
+	EphemeralStorage *KubeletFsStats `json:"ephemeral-storage,omitempty"`
+}
+
+// KubeletFsStats filesystem usage
+type KubeletFsStats struct {
+	AvailableBytes *uint64 `json:"availableBytes,omitempty"`
+	CapacityBytes  *uint64 `json:"capacityBytes,omitempty"`
+	UsedBytes      *uint64 `json:"usedBytes,omitempty"`
+}
+
+// KubeletVolumeStats usage of a pod volume
+type KubeletVolumeStats struct {
+	KubeletFsStats
+	Name   string               `json:"name"`
+	PVCRef *KubeletPodReference `json:"pvcRef,omitempty"`
+}
+
+// GetKubeletSummary reads the kubelet stats summary through the API server node proxy
+func GetKubeletSummary(client corev1.CoreV1Interface, nodeName string) (*KubeletSummary, error) {
+	resultRaw, err := GetKubeletEndpoint(client, nodeName, KubeletStatsSummary)
+	if err != nil {
+		return nil, err
+	}
+	summary := &KubeletSummary{}
+	if err := json.Unmarshal(resultRaw, summary); err != nil {
+		return nil, fmt.Errorf("failed to unmarshall kubelet summary: %v", err)
+	}
+	return summary, nil
+}
+
+// GetKubeletEndpoint reads a path of the kubelet of the node through the API server node proxy
+func GetKubeletEndpoint(client corev1.CoreV1Interface, nodeName string, path string) ([]byte, error) {
+	return client.RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix(path).
+		DoRaw()
+}
+
+func bytesQuantity(value *uint64) *resource.Quantity {
+	if value == nil {
+		return nil
+	}
+	return resource.NewQuantity(int64(*value), resource.BinarySI)
+}
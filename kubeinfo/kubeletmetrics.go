@@ -0,0 +1,422 @@
+package kubeinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	typesv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// Kubelet endpoints a KubeletMetricsClient reads usage from
+const (
+	KubeletResourceMetrics = "metrics/resource"
+	KubeletStatsSummary    = "stats/summary"
+	KubeletCadvisorMetrics = "metrics/cadvisor"
+)
+
+// kubeletSample cumulative CPU and the working set of a node or container as the kubelet reported them
+type kubeletSample struct {
+	time time.Time
+	// cpuSeconds cumulative core seconds, set when hasCPU
+	cpuSeconds float64
+	hasCPU     bool
+	// nanoCores rate the stats summary measures itself, used until there is a previous sample
+	nanoCores *uint64
+	memory    *uint64
+}
+
+// kubeletNodeSample samples of a node and of the containers running on it, containers keyed by namespace/pod then name
+type kubeletNodeSample struct {
+	node       kubeletSample
+	containers map[string]map[string]kubeletSample
+}
+
+// kubeletRate CPU rate measured up to a sample
+type kubeletRate struct {
+	sample kubeletSample
+	cores  *resource.Quantity
+	window time.Duration
+}
+
+// KubeletMetricsClient reads node and pod usage from the kubelet of each node through the API server node proxy,
+// for clusters without Heapster or metrics-server. CPU is the rate between the samples of successive calls,
+// so a client must be kept for as long as the collector it serves.
+type KubeletMetricsClient struct {
+	Client corev1.CoreV1Interface
+	// Endpoint KubeletResourceMetrics or KubeletStatsSummary
+	Endpoint string
+	// Fetch reads a path of the kubelet of a node, NewKubeletMetricsClient reads through the node proxy
+	Fetch func(nodeName string, path string) ([]byte, error)
+	// PageSize items requested in each list of the nodes and pods to read, zero lists everything at once
+	PageSize int64
+
+	lock  sync.Mutex
+	rates map[string]kubeletRate
+}
+
+// NewKubeletMetricsClient get client reading the endpoint of each kubelet
+func NewKubeletMetricsClient(client corev1.CoreV1Interface, endpoint string) *KubeletMetricsClient {
+	return &KubeletMetricsClient{
+		Client:   client,
+		Endpoint: endpoint,
+		Fetch: func(nodeName string, path string) ([]byte, error) {
+			return GetKubeletEndpoint(client, nodeName, path)
+		},
+		rates: map[string]kubeletRate{},
+	}
+}
+
+// GetNodeMetrics gets the metrics for a node, or for every node matching the selector.
+// Nodes whose kubelet does not respond are left out, unless none does.
+func (cli *KubeletMetricsClient) GetNodeMetrics(nodeName string, selector string) (*metricsapi.NodeMetricsList, error) {
+	nodeNames := []string{nodeName}
+	if nodeName == "" {
+		nodes, err := cli.source().Nodes(selector)
+		if err != nil {
+			return nil, err
+		}
+		nodeNames = nodeNames[:0]
+		for _, node := range nodes {
+			nodeNames = append(nodeNames, node.Name)
+		}
+	}
+	samples, err := cli.samples(nodeNames)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &metricsapi.NodeMetricsList{}
+	seen := map[string]bool{}
+	for _, name := range nodeNames {
+		sample, ok := samples[name]
+		if !ok {
+			continue
+		}
+		seen["node/"+name] = true
+		usage, timestamp, window := cli.usage("node/"+name, sample.node)
+		metrics.Items = append(metrics.Items, metricsapi.NodeMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Timestamp:  timestamp,
+			Window:     window,
+			Usage:      usage,
+		})
+	}
+	// a selected list does not cover every node another call may have read
+	if nodeName == "" && selector == "" {
+		cli.prune("node/", seen)
+	}
+	return metrics, nil
+}
+
+// GetPodMetrics gets the metrics for a pod, or for every pod in the namespace matching the selector.
+// The pods are listed to find the nodes to read, pods on nodes whose kubelet does not respond are left out.
+func (cli *KubeletMetricsClient) GetPodMetrics(namespace string, podName string, allNamespaces bool, selector labels.Selector) (*metricsapi.PodMetricsList, error) {
+	if allNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	var pods []typesv1.Pod
+	if podName != "" {
+		pod, err := cli.Client.Pods(namespace).Get(podName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		pods = []typesv1.Pod{*pod}
+	} else {
+		var err error
+		if pods, err = cli.source().Pods(namespace, selector.String()); err != nil {
+			return nil, err
+		}
+	}
+	nodeNames, seen := []string{}, map[string]bool{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && !seen[pod.Spec.NodeName] {
+			seen[pod.Spec.NodeName] = true
+			nodeNames = append(nodeNames, pod.Spec.NodeName)
+		}
+	}
+	samples, err := cli.samples(nodeNames)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &metricsapi.PodMetricsList{}
+	sampled := map[string]bool{}
+	for _, pod := range pods {
+		sample, ok := samples[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		containers := sample.containers[key]
+		if len(containers) == 0 {
+			continue
+		}
+		metric := metricsapi.PodMetrics{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+		for _, container := range pod.Spec.Containers {
+			sample, ok := containers[container.Name]
+			if !ok {
+				continue
+			}
+			sampled["pod/"+key+"/"+container.Name] = true
+			usage, timestamp, window := cli.usage("pod/"+key+"/"+container.Name, sample)
+			// the pod is as recent as its oldest container
+			if metric.Timestamp.IsZero() || timestamp.Before(&metric.Timestamp) {
+				metric.Timestamp, metric.Window = timestamp, window
+			}
+			metric.Containers = append(metric.Containers, metricsapi.ContainerMetrics{Name: container.Name, Usage: usage})
+		}
+		metrics.Items = append(metrics.Items, metric)
+	}
+	// a refresh lists each namespace it can access in turn, so only the rates of this namespace are dropped
+	if podName == "" {
+		prefix := "pod/"
+		if namespace != metav1.NamespaceAll {
+			prefix += namespace + "/"
+		}
+		cli.prune(prefix, sampled)
+	}
+	return metrics, nil
+}
+
+// prune drop the rates keyed under prefix that are not in seen
+func (cli *KubeletMetricsClient) prune(prefix string, seen map[string]bool) {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	for key := range cli.rates {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(cli.rates, key)
+		}
+	}
+}
+
+// source lists the nodes and pods to read in pages of PageSize
+func (cli *KubeletMetricsClient) source() *ClientSource {
+	return &ClientSource{Client: cli.Client, PageSize: cli.PageSize}
+}
+
+// samples reads the kubelet of each node, an error is only returned when no kubelet responds
+func (cli *KubeletMetricsClient) samples(nodeNames []string) (map[string]*kubeletNodeSample, error) {
+	samples := map[string]*kubeletNodeSample{}
+	var lastErr error
+	for _, nodeName := range nodeNames {
+		data, err := cli.Fetch(nodeName, cli.Endpoint)
+		if err == nil {
+			var sample *kubeletNodeSample
+			if cli.Endpoint == KubeletStatsSummary {
+				sample, err = parseKubeletSummary(data)
+			} else {
+				sample, err = parseResourceMetrics(data, time.Now())
+			}
+			if err == nil {
+				samples[nodeName] = sample
+				continue
+			}
+		}
+		lastErr = fmt.Errorf("failed to read kubelet %s of node %s: %v", cli.Endpoint, nodeName, err)
+	}
+	if len(samples) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return samples, nil
+}
+
+// usage CPU and memory of a sample, CPU is measured against the previous sample of key and left out until there is one.
+// A sample the kubelet has not refreshed since the last call keeps the rate measured then.
+func (cli *KubeletMetricsClient) usage(key string, sample kubeletSample) (typesv1.ResourceList, metav1.Time, metav1.Duration) {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	if cli.rates == nil {
+		cli.rates = map[string]kubeletRate{}
+	}
+	previous, ok := cli.rates[key]
+	rate := kubeletRate{sample: sample}
+	seconds := sample.time.Sub(previous.sample.time).Seconds()
+	switch {
+	case ok && seconds == 0:
+		rate = previous
+	case ok && seconds > 0 && sample.hasCPU && previous.sample.hasCPU && sample.cpuSeconds >= previous.sample.cpuSeconds:
+		rate.cores = resource.NewMilliQuantity(int64((sample.cpuSeconds-previous.sample.cpuSeconds)/seconds*1000), resource.DecimalSI)
+		rate.window = sample.time.Sub(previous.sample.time)
+	case sample.nanoCores != nil:
+		rate.cores = resource.NewMilliQuantity(int64(*sample.nanoCores/1000000), resource.DecimalSI)
+	}
+	cli.rates[key] = rate
+
+	usage := typesv1.ResourceList{}
+	if rate.cores != nil {
+		usage[typesv1.ResourceCPU] = *rate.cores
+	}
+	if sample.memory != nil {
+		usage[typesv1.ResourceMemory] = *bytesQuantity(sample.memory)
+	}
+	return usage, metav1.NewTime(sample.time), metav1.Duration{Duration: rate.window}
+}
+
+// parseKubeletSummary samples from a kubelet /stats/summary response
+func parseKubeletSummary(data []byte) (*kubeletNodeSample, error) {
+	summary := &KubeletSummary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, fmt.Errorf("failed to unmarshall kubelet summary: %v", err)
+	}
+	sample := &kubeletNodeSample{
+		node:       summaryCPUSample(summary.Node.CPU, summary.Node.Memory),
+		containers: map[string]map[string]kubeletSample{},
+	}
+	for _, pod := range summary.Pods {
+		containers := map[string]kubeletSample{}
+		for _, container := range pod.Containers {
+			containers[container.Name] = summaryCPUSample(container.CPU, container.Memory)
+		}
+		sample.containers[pod.PodRef.Namespace+"/"+pod.PodRef.Name] = containers
+	}
+	return sample, nil
+}
+
+func summaryCPUSample(cpu *KubeletCPUStats, memory *KubeletMemoryStats) kubeletSample {
+	sample := kubeletSample{}
+	if cpu != nil {
+		sample.time = cpu.Time.Time
+		sample.nanoCores = cpu.UsageNanoCores
+		if cpu.UsageCoreNanoSeconds != nil {
+			sample.cpuSeconds, sample.hasCPU = float64(*cpu.UsageCoreNanoSeconds)/1e9, true
+		}
+	}
+	if memory != nil {
+		sample.memory = memory.WorkingSetBytes
+	}
+	return sample
+}
+
+// parseResourceMetrics samples from a kubelet /metrics/resource response in Prometheus text format.
+// Samples without a timestamp are taken at now. Older kubelets name the labels container_name and pod_name.
+func parseResourceMetrics(data []byte, now time.Time) (*kubeletNodeSample, error) {
+	sample := &kubeletNodeSample{containers: map[string]map[string]kubeletSample{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, value, timestamp, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse kubelet resource metrics: %v", err)
+		}
+		if timestamp.IsZero() {
+			timestamp = now
+		}
+		switch name {
+		case "node_cpu_usage_seconds_total", "node_memory_working_set_bytes":
+			sample.node = addResourceMetric(sample.node, name, value, timestamp)
+		case "container_cpu_usage_seconds_total", "container_memory_working_set_bytes":
+			container, pod := firstLabel(labels, "container", "container_name"), firstLabel(labels, "pod", "pod_name")
+			if container == "" || pod == "" {
+				continue
+			}
+			key := labels["namespace"] + "/" + pod
+			if sample.containers[key] == nil {
+				sample.containers[key] = map[string]kubeletSample{}
+			}
+			sample.containers[key][container] = addResourceMetric(sample.containers[key][container], name, value, timestamp)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// addResourceMetric sample with the CPU counter or working set of a metric added, the CPU counter sets the time
+func addResourceMetric(sample kubeletSample, name string, value float64, timestamp time.Time) kubeletSample {
+	if strings.HasSuffix(name, "_cpu_usage_seconds_total") {
+		sample.time, sample.cpuSeconds, sample.hasCPU = timestamp, value, true
+		return sample
+	}
+	memory := uint64(value)
+	sample.memory = &memory
+	if sample.time.IsZero() {
+		sample.time = timestamp
+	}
+	return sample
+}
+
+func firstLabel(labels map[string]string, names ...string) string {
+	for _, name := range names {
+		if value := labels[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parsePrometheusLine name, labels, value and optional millisecond timestamp of a sample line
+func parsePrometheusLine(line string) (string, map[string]string, float64, time.Time, error) {
+	labels := map[string]string{}
+	name, rest := line, ""
+	if i := strings.IndexAny(line, "{ "); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	if strings.HasPrefix(rest, "{") {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, " ,")
+			if strings.HasPrefix(rest, "}") {
+				rest = rest[1:]
+				break
+			}
+			eq := strings.Index(rest, "=")
+			if eq < 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+				return "", nil, 0, time.Time{}, fmt.Errorf("malformed labels in %q", line)
+			}
+			key := strings.TrimSpace(rest[:eq])
+			rest = rest[eq+2:]
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(rest); i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					if rest[i] == 'n' {
+						value.WriteByte('\n')
+					} else {
+						value.WriteByte(rest[i])
+					}
+					continue
+				}
+				if rest[i] == '"' {
+					rest, closed = rest[i+1:], true
+					break
+				}
+				value.WriteByte(rest[i])
+			}
+			if !closed {
+				return "", nil, 0, time.Time{}, fmt.Errorf("unterminated label value in %q", line)
+			}
+			labels[key] = value.String()
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", nil, 0, time.Time{}, fmt.Errorf("malformed sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, time.Time{}, fmt.Errorf("malformed value in %q", line)
+	}
+	var timestamp time.Time
+	if len(fields) == 2 {
+		millis, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return "", nil, 0, time.Time{}, fmt.Errorf("malformed timestamp in %q", line)
+		}
+		timestamp = time.Unix(0, millis*int64(time.Millisecond))
+	}
+	return name, labels, value, timestamp, nil
+}
@@ -0,0 +1,254 @@
+package kubeinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	typesv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestParsePrometheusLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		name      string
+		labels    map[string]string
+		value     float64
+		timestamp time.Time
+		err       bool
+	}{
+		{line: "node_cpu_usage_seconds_total 12.5", name: "node_cpu_usage_seconds_total", labels: map[string]string{}, value: 12.5},
+		{
+			line:      `container_cpu_usage_seconds_total{container="web",namespace="default",pod="web-1"} 3 1760000000000`,
+			name:      "container_cpu_usage_seconds_total",
+			labels:    map[string]string{"container": "web", "namespace": "default", "pod": "web-1"},
+			value:     3,
+			timestamp: time.Unix(1760000000, 0),
+		},
+		{
+			line:   `metric{a="quote \" inside", b="back\\slash",c="new\nline"} 1`,
+			name:   "metric",
+			labels: map[string]string{"a": `quote " inside`, "b": `back\slash`, "c": "new\nline"},
+			value:  1,
+		},
+		{line: `metric{a="b",} 1e3`, name: "metric", labels: map[string]string{"a": "b"}, value: 1000},
+		{line: `metric{a="open} 1`, err: true},
+		{line: `metric{a=b} 1`, err: true},
+		{line: "metric", err: true},
+		{line: "metric one", err: true},
+		{line: "metric 1 soon", err: true},
+		{line: "metric 1 2 3", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			name, labels, value, timestamp, err := parsePrometheusLine(test.line)
+			if test.err {
+				if err == nil {
+					t.Errorf("parsePrometheusLine() = %q, %v, %v, want an error", name, labels, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePrometheusLine() error = %v", err)
+			}
+			if name != test.name || value != test.value || !timestamp.Equal(test.timestamp) || !reflect.DeepEqual(labels, test.labels) {
+				t.Errorf("parsePrometheusLine() = %q, %v, %v, %v, want %q, %v, %v, %v", name, labels, value, timestamp, test.name, test.labels, test.value, test.timestamp)
+			}
+		})
+	}
+}
+
+// kubeletRefresh canned kubelet response of a refresh and the CPU expected from it, empty when there is no rate yet
+type kubeletRefresh struct {
+	body    string
+	nodeCPU string
+	podCPU  map[string]string
+}
+
+// newTestKubeletMetricsClient client listing the pods from a fake API server and reading the body in turn from the kubelet,
+// lists counts the list requests the server answered
+func newTestKubeletMetricsClient(t *testing.T, endpoint string, body *string, lists *int, pods ...typesv1.Pod) *KubeletMetricsClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lists++
+		// pages of limit pods, continuing from the index in the token
+		list := typesv1.PodList{Items: pods}
+		start, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+		if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); limit > 0 && start+limit < len(pods) {
+			list.Items, list.Continue = pods[start:start+limit], strconv.Itoa(start+limit)
+		} else {
+			list.Items = pods[start:]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}))
+	t.Cleanup(server.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewKubeletMetricsClient(clientset.CoreV1(), endpoint)
+	client.Fetch = func(nodeName string, path string) ([]byte, error) {
+		if path != endpoint {
+			t.Errorf("Fetch() path = %q, want %q", path, endpoint)
+		}
+		return []byte(*body), nil
+	}
+	return client
+}
+
+func testPod(namespace string, name string, containers ...string) typesv1.Pod {
+	pod := typesv1.Pod{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace}, Spec: typesv1.PodSpec{NodeName: "n1"}}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, typesv1.Container{Name: container})
+	}
+	return pod
+}
+
+// checkKubeletRefreshes read each refresh through the client and compare the CPU of the node and of each pod
+func checkKubeletRefreshes(t *testing.T, endpoint string, refreshes []kubeletRefresh) {
+	body := ""
+	lists := 0
+	client := newTestKubeletMetricsClient(t, endpoint, &body, &lists, testPod("default", "web-1", "web"), testPod("team", "worker", "worker"))
+	for i, refresh := range refreshes {
+		body = refresh.body
+		nodes, err := client.GetNodeMetrics("n1", "")
+		if err != nil {
+			t.Fatalf("refresh %d: GetNodeMetrics() error = %v", i+1, err)
+		}
+		if len(nodes.Items) != 1 {
+			t.Fatalf("refresh %d: GetNodeMetrics() = %d nodes, want 1", i+1, len(nodes.Items))
+		}
+		if cpu := quantityString(resourceUsage(nodes.Items[0].Usage, typesv1.ResourceCPU)); cpu != refresh.nodeCPU {
+			t.Errorf("refresh %d: node cpu = %q, want %q", i+1, cpu, refresh.nodeCPU)
+		}
+		pods, err := client.GetPodMetrics(v1.NamespaceAll, "", true, labels.Everything())
+		if err != nil {
+			t.Fatalf("refresh %d: GetPodMetrics() error = %v", i+1, err)
+		}
+		got := map[string]string{}
+		for _, pod := range pods.Items {
+			for _, container := range pod.Containers {
+				got[pod.Namespace+"/"+pod.Name+"/"+container.Name] = quantityString(resourceUsage(container.Usage, typesv1.ResourceCPU))
+			}
+		}
+		if !reflect.DeepEqual(got, refresh.podCPU) {
+			t.Errorf("refresh %d: pod cpu = %v, want %v", i+1, got, refresh.podCPU)
+		}
+	}
+}
+
+// resourceMetrics /metrics/resource body at the millisecond timestamp, older kubelets label containers with container_name and pod_name
+func resourceMetrics(millis string, node string, web string, worker string) string {
+	return strings.Join([]string{
+		"# HELP node_cpu_usage_seconds_total [ALPHA] Cumulative cpu time consumed by the node in core-seconds",
+		"# TYPE node_cpu_usage_seconds_total counter",
+		"node_cpu_usage_seconds_total " + node + " " + millis,
+		"node_memory_working_set_bytes 1.073741824e+09 " + millis,
+		`container_cpu_usage_seconds_total{container="web",namespace="default",pod="web-1"} ` + web + " " + millis,
+		`container_memory_working_set_bytes{container="web",namespace="default",pod="web-1"} 1.34217728e+08 ` + millis,
+		`container_cpu_usage_seconds_total{container_name="worker",namespace="team",pod_name="worker"} ` + worker + " " + millis,
+		`container_cpu_usage_seconds_total{container="POD",namespace="team",pod="other"} 1 ` + millis,
+		"",
+	}, "\n")
+}
+
+func TestKubeletMetricsClientResourceMetrics(t *testing.T) {
+	checkKubeletRefreshes(t, KubeletResourceMetrics, []kubeletRefresh{
+		// counters alone give no rate until the second sample
+		{
+			body:    resourceMetrics("1760000000000", "100", "10", "5"),
+			nodeCPU: "",
+			podCPU:  map[string]string{"default/web-1/web": "", "team/worker/worker": ""},
+		},
+		// the worker restarted so its counter went back
+		{
+			body:    resourceMetrics("1760000010000", "105", "11", "1"),
+			nodeCPU: "500m",
+			podCPU:  map[string]string{"default/web-1/web": "100m", "team/worker/worker": ""},
+		},
+		// a sample the kubelet has not refreshed keeps the rate measured before
+		{
+			body:    resourceMetrics("1760000010000", "105", "11", "1"),
+			nodeCPU: "500m",
+			podCPU:  map[string]string{"default/web-1/web": "100m", "team/worker/worker": ""},
+		},
+		{
+			body:    resourceMetrics("1760000020000", "107", "13", "2"),
+			nodeCPU: "200m",
+			podCPU:  map[string]string{"default/web-1/web": "200m", "team/worker/worker": "100m"},
+		},
+	})
+}
+
+// statsSummary /stats/summary body at the time with the cumulative core nanoseconds and the kubelet's own nanoCores
+func statsSummary(at string, node string, web string, webNanoCores string) string {
+	return `{
+  "node": {"nodeName": "n1", "cpu": {"time": "` + at + `", "usageNanoCores": 300000000, "usageCoreNanoSeconds": ` + node + `}, "memory": {"workingSetBytes": 1073741824}},
+  "pods": [
+    {
+      "podRef": {"name": "web-1", "namespace": "default"},
+      "containers": [{"name": "web", "cpu": {"time": "` + at + `", "usageNanoCores": ` + webNanoCores + `, "usageCoreNanoSeconds": ` + web + `}}]
+    }
+  ]
+}`
+}
+
+func TestKubeletMetricsClientStatsSummary(t *testing.T) {
+	checkKubeletRefreshes(t, KubeletStatsSummary, []kubeletRefresh{
+		// the first sample falls back to the kubelet's own rate
+		{
+			body:    statsSummary("2026-10-10T10:00:00Z", "100000000000", "10000000000", "50000000"),
+			nodeCPU: "300m",
+			podCPU:  map[string]string{"default/web-1/web": "50m"},
+		},
+		{
+			body:    statsSummary("2026-10-10T10:00:10Z", "104000000000", "11000000000", "50000000"),
+			nodeCPU: "400m",
+			podCPU:  map[string]string{"default/web-1/web": "100m"},
+		},
+		// a counter reset falls back to the kubelet's own rate again
+		{
+			body:    statsSummary("2026-10-10T10:00:20Z", "106000000000", "1000000000", "70000000"),
+			nodeCPU: "200m",
+			podCPU:  map[string]string{"default/web-1/web": "70m"},
+		},
+	})
+}
+
+func TestKubeletMetricsClientPages(t *testing.T) {
+	body := resourceMetrics("1760000000000", "100", "10", "5")
+	pods := []typesv1.Pod{testPod("default", "web-1", "web"), testPod("default", "web-2", "web"), testPod("team", "worker", "worker")}
+	tests := []struct {
+		pageSize int64
+		lists    int
+	}{
+		{pageSize: 0, lists: 1},
+		{pageSize: 1, lists: 3},
+		{pageSize: 2, lists: 2},
+	}
+	for _, test := range tests {
+		pageSize, lists := test.pageSize, 0
+		client := newTestKubeletMetricsClient(t, KubeletResourceMetrics, &body, &lists, pods...)
+		client.PageSize = pageSize
+		metrics, err := client.GetPodMetrics(v1.NamespaceAll, "", true, labels.Everything())
+		if err != nil {
+			t.Fatalf("page size %d: GetPodMetrics() error = %v", pageSize, err)
+		}
+		// web-2 has no sample
+		if len(metrics.Items) != 2 {
+			t.Errorf("page size %d: GetPodMetrics() = %d pods, want 2", pageSize, len(metrics.Items))
+		}
+		if lists != test.lists {
+			t.Errorf("page size %d: GetPodMetrics() listed %d pages, want %d", pageSize, lists, test.lists)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// KubeletUsage network, filesystem and memory detail of a node or pod from the kubelet stats summary
+type KubeletUsage struct {
+	// NetworkRx and NetworkTx bytes per second since the previous refresh, unset on the first
+	NetworkRx *resource.Quantity `json:",omitempty"`
+	NetworkTx *resource.Quantity `json:",omitempty"`
+	// RootFs and ImageFs filesystems of a node, the image filesystem holds container images and writable layers
+	RootFsUsed      *resource.Quantity `json:",omitempty"`
+	RootFsCapacity  *resource.Quantity `json:",omitempty"`
+	RootFsPercent   *inf.Dec           `json:",omitempty"`
+	ImageFsUsed     *resource.Quantity `json:",omitempty"`
+	ImageFsCapacity *resource.Quantity `json:",omitempty"`
+	ImageFsPercent  *inf.Dec           `json:",omitempty"`
+	// Ephemeral storage used by a pod against the sum of its container limits, pods past their limit are evicted
+	EphemeralUsed    *resource.Quantity `json:",omitempty"`
+	EphemeralLimit   *resource.Quantity `json:",omitempty"`
+	EphemeralPercent *inf.Dec           `json:",omitempty"`
+	WorkingSet       *resource.Quantity `json:",omitempty"`
+	RSS              *resource.Quantity `json:",omitempty"`
+}
+
+// networkSample cumulative network bytes at the time the kubelet sampled them
+type networkSample struct {
+	time time.Time
+	rx   uint64
+	tx   uint64
+	// seen when a refresh read the sample
+	seen time.Time
+}
+
+// NetworkHistory previous network sample of each node and pod, rates are measured between refreshes
+type NetworkHistory map[string]networkSample
+
+// rates bytes per second since the previous sample of key, nil until there are two samples
+func (h NetworkHistory) rates(key string, network *KubeletNetworkStats) (*resource.Quantity, *resource.Quantity) {
+	if network == nil || network.RxBytes == nil || network.TxBytes == nil {
+		return nil, nil
+	}
+	sample := networkSample{time: network.Time.Time, rx: *network.RxBytes, tx: *network.TxBytes, seen: time.Now()}
+	previous, ok := h[key]
+	h[key] = sample
+	seconds := sample.time.Sub(previous.time).Seconds()
+	// counters reset when an interface or pod is recreated
+	if !ok || seconds <= 0 || sample.rx < previous.rx || sample.tx < previous.tx {
+		return nil, nil
+	}
+	rx := resource.NewQuantity(int64(float64(sample.rx-previous.rx)/seconds), resource.BinarySI)
+	tx := resource.NewQuantity(int64(float64(sample.tx-previous.tx)/seconds), resource.BinarySI)
+	return rx, tx
+}
+
+// prune drop the nodes and pods whose sample was last read before since
+func (h NetworkHistory) prune(since time.Time) {
+	for key, sample := range h {
+		if sample.seen.Before(since) {
+			delete(h, key)
+		}
+	}
+}
+
+// fsUsage used and capacity of a filesystem with the percentage used
+func fsUsage(fs *KubeletFsStats) (*resource.Quantity, *resource.Quantity, *inf.Dec) {
+	if fs == nil || fs.UsedBytes == nil {
+		return nil, nil, nil
+	}
+	used, capacity := bytesQuantity(fs.UsedBytes), bytesQuantity(fs.CapacityBytes)
+	if capacity == nil {
+		return used, nil, nil
+	}
+	return used, capacity, optionalPercentage(used, capacity)
+}
+
+func (usage *KubeletUsage) setMemory(memory *KubeletMemoryStats) {
+	if memory != nil {
+		usage.WorkingSet = bytesQuantity(memory.WorkingSetBytes)
+		usage.RSS = bytesQuantity(memory.RSSBytes)
+	}
+}
+
+// kubeletSummaries stats summary of each node, stopping at the deadline. Nodes that fail are left out.
+func (c *Collector) kubeletSummaries(nodeNames []string, deadline time.Time) (map[string]*KubeletSummary, []string, []error) {
+	summaries := map[string]*KubeletSummary{}
+	var unavailable []string
+	var errs []error
+	for _, nodeName := range nodeNames {
+		if expired(deadline) {
+			errs = append(errs, fmt.Errorf("timed out after %s before fetching kubelet stats of %d nodes", c.RefreshTimeout, len(nodeNames)-len(summaries)))
+			break
+		}
+		summary, err := c.Source.KubeletSummary(nodeName)
+		if apierrors.IsForbidden(err) {
+			unavailable = append(unavailable, UnavailableKubelet)
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get kubelet stats for node %s: %v", nodeName, err))
+			continue
+		}
+		summaries[nodeName] = summary
+	}
+	return summaries, unavailable, errs
+}
+
+// nodeKubeletUsage usage of the node from its kubelet summary
+func (c *Collector) nodeKubeletUsage(summary *KubeletSummary) *KubeletUsage {
+	node := summary.Node
+	usage := &KubeletUsage{}
+	usage.NetworkRx, usage.NetworkTx = c.Network.rates("node/"+node.NodeName, node.Network)
+	usage.RootFsUsed, usage.RootFsCapacity, usage.RootFsPercent = fsUsage(node.Fs)
+	if node.Runtime != nil {
+		usage.ImageFsUsed, usage.ImageFsCapacity, usage.ImageFsPercent = fsUsage(node.Runtime.ImageFs)
+	}
+	usage.setMemory(node.Memory)
+	return usage
+}
+
+// podKubeletUsage usage of the pod from the kubelet summary of its node, nil when the kubelet has no stats for it
+func (c *Collector) podKubeletUsage(summary *KubeletSummary, pod typesv1.Pod) *KubeletUsage {
+	for _, stats := range summary.Pods {
+		if stats.PodRef.Namespace != pod.Namespace || stats.PodRef.Name != pod.Name {
+			continue
+		}
+		usage := &KubeletUsage{}
+		usage.NetworkRx, usage.NetworkTx = c.Network.rates("pod/"+pod.Namespace+"/"+pod.Name, stats.Network)
+		if stats.EphemeralStorage != nil {
+			usage.EphemeralUsed = bytesQuantity(stats.EphemeralStorage.UsedBytes)
+		}
+		limit := &resource.Quantity{}
+		for _, container := range pod.Spec.Containers {
+			if value, ok := container.Resources.Limits[typesv1.ResourceEphemeralStorage]; ok {
+				limit.Add(value)
+			}
+		}
+		if !limit.IsZero() {
+			usage.EphemeralLimit = limit
+			if usage.EphemeralUsed != nil {
+				usage.EphemeralPercent = percentage(usage.EphemeralUsed, limit)
+			}
+		}
+		// pod level memory stats are not reported by every kubelet version, so sum the containers
+		workingSet, rss := &resource.Quantity{}, &resource.Quantity{}
+		for _, container := range stats.Containers {
+			if container.Memory == nil {
+				continue
+			}
+			if value := bytesQuantity(container.Memory.WorkingSetBytes); value != nil {
+				workingSet.Add(*value)
+				usage.WorkingSet = workingSet
+			}
+			if value := bytesQuantity(container.Memory.RSSBytes); value != nil {
+				rss.Add(*value)
+				usage.RSS = rss
+			}
+		}
+		return usage
+	}
+	return nil
+}
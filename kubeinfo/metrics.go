@@ -1,4 +1,4 @@
-package main
+package kubeinfo
 
 import (
 	"encoding/json"
@@ -58,6 +58,9 @@ func podMetricsURL(namespace string, name string) (string, error) {
 	if namespace == metav1.NamespaceAll {
 		return fmt.Sprintf("%s/pods", metricsRoot), nil
 	}
+	if name == "" {
+		return fmt.Sprintf("%s/namespaces/%s/pods", metricsRoot, namespace), nil
+	}
 	return fmt.Sprintf("%s/namespaces/%s/pods/%s", metricsRoot, namespace, name), nil
 }
 
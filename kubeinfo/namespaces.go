@@ -0,0 +1,88 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+
+	typesv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceStats pod counts and usage of a namespace
+type NamespaceStats struct {
+	Name        string
+	Pods        int
+	Running     int
+	Failing     int
+	Restarts    int
+	CPUUsage    *resource.Quantity
+	MemoryUsage *resource.Quantity
+}
+
+// NamespaceReport result of collecting the namespaces view
+type NamespaceReport struct {
+	Namespaces []NamespaceStats
+	// Errors non fatal failures, usage is left empty
+	Errors []error `json:"-"`
+}
+
+// Namespaces collect pod counts and usage totals for each namespace with pods
+func (c *Collector) Namespaces() (*NamespaceReport, error) {
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := labels.Parse(c.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	report := &NamespaceReport{}
+	namespaces := map[string]*NamespaceStats{}
+	for _, pod := range pods {
+		stats, ok := namespaces[pod.Namespace]
+		if !ok {
+			stats = &NamespaceStats{Name: pod.Namespace, CPUUsage: &resource.Quantity{}, MemoryUsage: &resource.Quantity{}}
+			namespaces[pod.Namespace] = stats
+		}
+		stats.Pods++
+		if pod.Status.Phase == typesv1.PodRunning {
+			stats.Running++
+		} else {
+			stats.Failing++
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			stats.Restarts += int(status.RestartCount)
+		}
+	}
+	metrics, err := c.listPodMetrics(selector)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get pod metrics: %v", err))
+	} else {
+		unmeasured := 0
+		for _, metric := range metrics.Items {
+			stats, ok := namespaces[metric.Namespace]
+			if !ok {
+				continue
+			}
+			var cpu *resource.Quantity
+			for _, container := range metric.Containers {
+				cpu = addUsage(cpu, container.Usage, typesv1.ResourceCPU)
+				stats.MemoryUsage.Add(*container.Usage.Memory())
+			}
+			if cpu == nil {
+				unmeasured++
+			} else {
+				stats.CPUUsage.Add(*cpu)
+			}
+		}
+		if unmeasured > 0 {
+			report.Errors = append(report.Errors, unmeasuredError(unmeasured, "pods"))
+		}
+	}
+	for _, stats := range namespaces {
+		report.Namespaces = append(report.Namespaces, *stats)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Name < report.Namespaces[j].Name })
+	return report, nil
+}
@@ -0,0 +1,279 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// NodeStats usage and state of a node
+type NodeStats struct {
+	Name              string
+	CPUUsage          *resource.Quantity
+	CPUAllocatable    *resource.Quantity
+	CPUPercent        *inf.Dec
+	MemoryUsage       *resource.Quantity
+	MemoryAllocatable *resource.Quantity
+	MemoryPercent     *inf.Dec
+	PodCount          int
+	State             string
+	Zone              string
+	KubeletVersion    string
+	InternalIP        string
+	Created           time.Time
+	Labels            map[string]string
+	Events            *EventGroup
+	// TimedOut the metrics of the node were not fetched before the refresh deadline, usage is unknown
+	TimedOut bool `json:",omitempty"`
+	// MetricSample freshness of the usage, usage is unknown when the sample is stale and excluded
+	MetricSample *MetricSample `json:",omitempty"`
+	// Kubelet detail from the kubelet stats summary, when asked for
+	Kubelet *KubeletUsage `json:",omitempty"`
+}
+
+// FailingPod pod in the nodes view that is not running
+type FailingPod struct {
+	Name      string
+	Namespace string
+	Phase     typesv1.PodPhase
+	Events    *EventGroup
+}
+
+// NodeReport result of collecting the nodes view
+type NodeReport struct {
+	Summary *ClusterSummary `json:",omitempty"`
+	Nodes   []NodeStats
+	// Groups nodes aggregated by the value of GroupByLabel, when set
+	Groups  []NodeGroup `json:",omitempty"`
+	Failing []FailingPod
+	Pending []*PendingPod
+	// Unavailable data the user may not read, kubelet stats need nodes/proxy
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, affected rows are left out
+	Errors []error `json:"-"`
+}
+
+// FailingReport result of collecting the failing view
+type FailingReport struct {
+	Failing []FailingPod
+	Pending []*PendingPod
+	// Unavailable data the user may not read, pending pods are not analysed without nodes
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, affected rows are left out
+	Errors []error `json:"-"`
+}
+
+// zoneLabels labels holding the zone of a node, newest first
+var zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+
+// NodeZone availability zone of the node, empty if it is not labelled
+func NodeZone(node typesv1.Node) string {
+	for _, label := range zoneLabels {
+		if zone, ok := node.Labels[label]; ok {
+			return zone
+		}
+	}
+	return ""
+}
+
+func nodeInternalIP(node typesv1.Node) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == typesv1.NodeInternalIP {
+			return address.Address
+		}
+	}
+	return ""
+}
+
+func nodeState(node typesv1.Node) string {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == typesv1.NodeReady {
+			switch condition.Status {
+			case typesv1.ConditionTrue:
+				return "Ready"
+			case typesv1.ConditionFalse:
+				return "Not Ready"
+			case typesv1.ConditionUnknown:
+				return "Unknown"
+			}
+		}
+	}
+	return ""
+}
+
+// Nodes collect usage for every node, along with the pods in the namespace that are not running
+func (c *Collector) Nodes() (*NodeReport, error) {
+	start := time.Now()
+	deadline := c.deadline(start)
+	nodes, err := c.listNodes()
+	if apierrors.IsForbidden(err) {
+		return nil, fmt.Errorf("%v\nthe pods, namespaces and failing views only need access to pods", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	report := &NodeReport{}
+	nodePods := map[string][]string{}
+	for _, pod := range pods {
+		nodePods[pod.Spec.NodeName] = append(nodePods[pod.Spec.NodeName], pod.Name)
+	}
+	warnings, err := c.WarningEvents()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get warning events: %v", err))
+		warnings = map[string]*EventGroup{}
+	}
+	// one list call for every node, a call per node would outlast the deadline on large clusters at the default QPS
+	var metrics *metricsapi.NodeMetricsList
+	timedOut := expired(deadline)
+	if !timedOut {
+		metrics, err = c.Metrics.GetNodeMetrics("", c.NodeSelector)
+		if err != nil && expired(deadline) {
+			timedOut = true
+		} else if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to get node metrics: %v", err))
+		}
+	}
+	nodeMetrics := map[string]metricsapi.NodeMetrics{}
+	if metrics != nil {
+		for _, metric := range metrics.Items {
+			nodeMetrics[metric.Name] = metric
+		}
+	}
+	stale := 0
+	for _, node := range nodes {
+		stats := NodeStats{
+			Name:              node.Name,
+			CPUAllocatable:    node.Status.Allocatable.Cpu(),
+			MemoryAllocatable: node.Status.Allocatable.Memory(),
+			PodCount:          len(nodePods[node.Name]),
+			State:             nodeState(node),
+			Zone:              NodeZone(node),
+			KubeletVersion:    node.Status.NodeInfo.KubeletVersion,
+			InternalIP:        nodeInternalIP(node),
+			Created:           node.CreationTimestamp.Time,
+			Labels:            node.Labels,
+			Events:            warnings[eventKey("Node", "", node.Name)],
+		}
+		if timedOut {
+			stats.TimedOut = true
+			report.Nodes = append(report.Nodes, stats)
+			continue
+		}
+		// the state, pods and events of a node are still shown when its metrics could not be fetched
+		if metrics == nil {
+			report.Nodes = append(report.Nodes, stats)
+			continue
+		}
+		metric, ok := nodeMetrics[node.Name]
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to get metrics for node %s: no metrics returned", node.Name))
+			continue
+		}
+		stats.MetricSample = c.metricSample(metric.Timestamp, metric.Window, time.Now())
+		if stats.MetricSample != nil && stats.MetricSample.Stale {
+			stale++
+		}
+		if !c.excluded(stats.MetricSample) {
+			if stats.CPUUsage = resourceUsage(metric.Usage, typesv1.ResourceCPU); stats.CPUUsage != nil {
+				stats.CPUPercent = percentage(stats.CPUUsage, stats.CPUAllocatable)
+			}
+			if stats.MemoryUsage = resourceUsage(metric.Usage, typesv1.ResourceMemory); stats.MemoryUsage != nil {
+				stats.MemoryPercent = percentage(stats.MemoryUsage, stats.MemoryAllocatable)
+			}
+		}
+		report.Nodes = append(report.Nodes, stats)
+	}
+	if timedOut {
+		report.Errors = append(report.Errors, fmt.Errorf("timed out after %s before fetching the metrics of %d nodes", c.RefreshTimeout, len(nodes)))
+	}
+	if stale > 0 {
+		report.Errors = append(report.Errors, c.staleError(stale, "nodes"))
+	}
+	if c.KubeletStats {
+		nodeNames := []string{}
+		for _, stats := range report.Nodes {
+			nodeNames = append(nodeNames, stats.Name)
+		}
+		summaries, unavailable, errs := c.kubeletSummaries(nodeNames, deadline)
+		report.Unavailable = append(report.Unavailable, unavailable...)
+		report.Errors = append(report.Errors, errs...)
+		for i := range report.Nodes {
+			if summary, ok := summaries[report.Nodes[i].Name]; ok {
+				report.Nodes[i].Kubelet = c.nodeKubeletUsage(summary)
+			}
+		}
+	}
+	report.Failing = failingPods(pods, warnings)
+	// the pending analysis and the summary list every pod and fetch metrics again, each call could take the whole timeout
+	if expired(deadline) {
+		report.Errors = append(report.Errors, fmt.Errorf("timed out after %s before analysing pending pods", c.RefreshTimeout))
+	} else if report.Pending, err = c.pendingPods(nodes, pods); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to analyse pending pods: %v", err))
+	}
+	if c.GroupByLabel != "" {
+		report.Groups = GroupNodes(report.Nodes, c.GroupByLabel)
+	}
+	switch {
+	case c.SkipSummary:
+	case expired(deadline):
+		report.Errors = append(report.Errors, fmt.Errorf("timed out after %s before the summary", c.RefreshTimeout))
+	default:
+		report.Summary = c.summarise(nodes, pods, metrics, nil)
+		report.Errors = append(report.Errors, report.Summary.Errors...)
+	}
+	c.Network.prune(start)
+	return report, nil
+}
+
+func failingPods(pods []typesv1.Pod, warnings map[string]*EventGroup) []FailingPod {
+	failing := []FailingPod{}
+	for _, pod := range pods {
+		if pod.Status.Phase != typesv1.PodRunning {
+			failing = append(failing, FailingPod{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+				Phase:     pod.Status.Phase,
+				Events:    warnings[eventKey("Pod", pod.Namespace, pod.Name)],
+			})
+		}
+	}
+	sort.Slice(failing, func(i, j int) bool { return failing[i].Name < failing[j].Name })
+	return failing
+}
+
+// Failing collect the pods in the namespace that are not running and why any pending ones are not scheduled
+func (c *Collector) Failing() (*FailingReport, error) {
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	report := &FailingReport{}
+	warnings, err := c.WarningEvents()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get warning events: %v", err))
+		warnings = map[string]*EventGroup{}
+	}
+	report.Failing = failingPods(pods, warnings)
+	nodes, err := c.listNodes()
+	if apierrors.IsForbidden(err) {
+		report.Unavailable = append(report.Unavailable, UnavailableNodes)
+		return report, nil
+	}
+	if err == nil {
+		report.Pending, err = c.pendingPods(nodes, pods)
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to analyse pending pods: %v", err))
+	}
+	return report, nil
+}
@@ -0,0 +1,334 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// PodStats usage and state of a pod
+type PodStats struct {
+	Name            string
+	Namespace       string
+	Node            string
+	CPUUsage        *resource.Quantity
+	CPUPercent      *inf.Dec
+	MemoryUsage     *resource.Quantity
+	MemoryPercent   *inf.Dec
+	Phase           typesv1.PodPhase
+	Created         time.Time
+	StartTime       time.Time
+	ReadyContainers int
+	TotalContainers int
+	PodIP           string
+	HostIP          string
+	QOSClass        typesv1.PodQOSClass
+	// Owner kind/name of the controller managing the pod
+	Owner          string
+	Labels         map[string]string
+	Restarts       int
+	RecentRestarts int
+	LastRestart    time.Time
+	CrashLooping   bool
+	Containers     []ContainerRestart
+	// TimedOut the metrics of the pod did not arrive before the refresh deadline, usage is unknown
+	TimedOut bool `json:",omitempty"`
+	// MetricSample freshness of the usage, usage is unknown when the sample is stale and excluded
+	MetricSample *MetricSample `json:",omitempty"`
+	// Kubelet detail from the kubelet stats summary of the node, when asked for
+	Kubelet *KubeletUsage `json:",omitempty"`
+}
+
+// PodReport result of collecting the pods view
+type PodReport struct {
+	Summary *ClusterSummary `json:",omitempty"`
+	Pods    []PodStats
+	// Namespaces subtotals for each namespace, when more than one namespace is collected
+	Namespaces []NamespaceStats `json:",omitempty"`
+	// Unavailable data the user may not read, CPU and memory % need the allocatable of nodes, kubelet stats need nodes/proxy
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, usage of the affected pods is left empty
+	Errors []error `json:"-"`
+}
+
+type podMetricsResult struct {
+	metrics *metricsapi.PodMetricsList
+	err     error
+}
+
+// fetchPodMetrics usage of every pod collected in a single call, an empty list when it fails or the deadline passes first
+func (c *Collector) fetchPodMetrics(deadline time.Time, report *PodReport) (metrics *metricsapi.PodMetricsList, timedOut bool) {
+	selector, err := labels.Parse(c.LabelSelector)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get pod metrics: %v", err))
+		return &metricsapi.PodMetricsList{}, false
+	}
+	// buffered so a fetch still running at the deadline does not block
+	fetched := make(chan podMetricsResult, 1)
+	go func() {
+		metrics, err := c.listPodMetrics(selector)
+		fetched <- podMetricsResult{metrics, err}
+	}()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timeout = time.After(time.Until(deadline))
+	}
+	select {
+	case result := <-fetched:
+		if result.err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to get pod metrics: %v", result.err))
+			return &metricsapi.PodMetricsList{}, false
+		}
+		return result.metrics, false
+	case <-timeout:
+		report.Errors = append(report.Errors, fmt.Errorf("timed out after %s waiting for pod metrics", c.RefreshTimeout))
+		return &metricsapi.PodMetricsList{}, true
+	}
+}
+
+// Pods collect usage for every pod in the namespace, joining the pods with the metrics of the whole namespace fetched at once
+func (c *Collector) Pods() (*PodReport, error) {
+	start := time.Now()
+	deadline := c.deadline(start)
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	c.Restarts.Record(pods, time.Now())
+	c.Restarts.Prune(start)
+
+	report := &PodReport{}
+	nodes := c.podNodes(report)
+	metrics, timedOut := c.fetchPodMetrics(deadline, report)
+	join := c.newPodUsageJoin(metrics, nodes, timedOut)
+	summaries := map[string]*KubeletSummary{}
+	if c.KubeletStats {
+		nodeNames, seen := []string{}, map[string]bool{}
+		for _, pod := range pods {
+			if pod.Spec.NodeName != "" && !seen[pod.Spec.NodeName] {
+				seen[pod.Spec.NodeName] = true
+				nodeNames = append(nodeNames, pod.Spec.NodeName)
+			}
+		}
+		var unavailable []string
+		var errs []error
+		summaries, unavailable, errs = c.kubeletSummaries(nodeNames, deadline)
+		report.Unavailable = append(report.Unavailable, unavailable...)
+		report.Errors = append(report.Errors, errs...)
+	}
+	for _, pod := range pods {
+		stats := join.stats(c.newPodStats(pod), pod)
+		if summary, ok := summaries[pod.Spec.NodeName]; ok {
+			stats.Kubelet = c.podKubeletUsage(summary, pod)
+		}
+		report.Pods = append(report.Pods, stats)
+	}
+	if join.stale > 0 {
+		report.Errors = append(report.Errors, c.staleError(join.stale, "pods"))
+	}
+	sort.Slice(report.Pods, func(i, j int) bool {
+		if report.Pods[i].Namespace != report.Pods[j].Namespace {
+			return report.Pods[i].Namespace < report.Pods[j].Namespace
+		}
+		return report.Pods[i].Name < report.Pods[j].Name
+	})
+	if c.Namespace == v1.NamespaceAll || c.AccessibleNamespaces != nil {
+		report.Namespaces = namespaceSubtotals(report.Pods)
+	}
+	// the summary lists every pod and may fetch metrics again, which could take the whole timeout
+	switch {
+	case c.SkipSummary:
+	case expired(deadline):
+		report.Errors = append(report.Errors, fmt.Errorf("timed out after %s before the summary", c.RefreshTimeout))
+	default:
+		report.Summary = c.summarise(nodes, pods, nil, metrics)
+		report.Summary.Unavailable = report.Unavailable
+		report.Errors = append(report.Errors, report.Summary.Errors...)
+	}
+	c.Network.prune(start)
+	return report, nil
+}
+
+// podNodes nodes for the allocatable the pod CPU and memory % are measured against, none when they cannot be listed
+func (c *Collector) podNodes(report *PodReport) []typesv1.Node {
+	nodes, err := c.listNodes()
+	if apierrors.IsForbidden(err) {
+		report.Unavailable = append(report.Unavailable, UnavailableNodes)
+	} else if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to list nodes, CPU and memory %% are unknown: %v", err))
+	}
+	return nodes
+}
+
+// podUsageJoin metrics of the pods collected indexed by pod, with the allocatable of their nodes
+type podUsageJoin struct {
+	collector   *Collector
+	usage       map[string]metricsapi.PodMetrics
+	usageByName map[string]metricsapi.PodMetrics
+	allocatable map[string]typesv1.ResourceList
+	timedOut    bool
+	// stale count of the pods joined with a stale sample
+	stale int
+}
+
+func (c *Collector) newPodUsageJoin(metrics *metricsapi.PodMetricsList, nodes []typesv1.Node, timedOut bool) *podUsageJoin {
+	join := &podUsageJoin{
+		collector:   c,
+		usage:       map[string]metricsapi.PodMetrics{},
+		usageByName: map[string]metricsapi.PodMetrics{},
+		allocatable: map[string]typesv1.ResourceList{},
+		timedOut:    timedOut,
+	}
+	// metrics read from kubectl top output may not have a namespace
+	for _, metric := range metrics.Items {
+		if metric.Namespace == "" {
+			join.usageByName[metric.Name] = metric
+		} else {
+			join.usage[metric.Namespace+"/"+metric.Name] = metric
+		}
+	}
+	for _, node := range nodes {
+		join.allocatable[node.Name] = node.Status.Allocatable
+	}
+	return join
+}
+
+// stats the pod stats with the usage of the pod, summed over its containers
+func (join *podUsageJoin) stats(stats PodStats, pod typesv1.Pod) PodStats {
+	metric, ok := join.usage[pod.Namespace+"/"+pod.Name]
+	if !ok {
+		metric, ok = join.usageByName[pod.Name]
+	}
+	if ok && !join.timedOut {
+		stats.MetricSample = join.collector.metricSample(metric.Timestamp, metric.Window, time.Now())
+		if stats.MetricSample != nil && stats.MetricSample.Stale {
+			join.stale++
+		}
+	}
+	switch {
+	case join.timedOut:
+		stats.TimedOut = true
+	case ok && !join.collector.excluded(stats.MetricSample):
+		for _, container := range metric.Containers {
+			stats.CPUUsage = addUsage(stats.CPUUsage, container.Usage, typesv1.ResourceCPU)
+			stats.MemoryUsage = addUsage(stats.MemoryUsage, container.Usage, typesv1.ResourceMemory)
+		}
+		node := join.allocatable[pod.Spec.NodeName]
+		if stats.CPUUsage != nil {
+			stats.CPUPercent = optionalPercentage(stats.CPUUsage, node.Cpu())
+		}
+		if stats.MemoryUsage != nil {
+			stats.MemoryPercent = optionalPercentage(stats.MemoryUsage, node.Memory())
+		}
+	}
+	return stats
+}
+
+// StreamPods call page with the stats of each page of pods as it arrives from the API server, so the pods are never all held.
+// Usage of every pod is still fetched in one response when the first page arrives, after any namespace discovery.
+// page is also given the data the user may not read, which is known before the first page so columns can be chosen up front.
+// There is no summary, ordering, subtotals or kubelet detail, the report returned only holds the errors and unavailable data.
+func (c *Collector) StreamPods(page func(pods []PodStats, unavailable []string) error) (*PodReport, error) {
+	start := time.Now()
+	deadline := c.deadline(start)
+	report := &PodReport{}
+	nodes := c.podNodes(report)
+	var join *podUsageJoin
+	err := c.eachPodPage(func(pods []typesv1.Pod) error {
+		if join == nil {
+			metrics, timedOut := c.fetchPodMetrics(deadline, report)
+			join = c.newPodUsageJoin(metrics, nodes, timedOut)
+		}
+		c.Restarts.Record(pods, time.Now())
+		stats := make([]PodStats, 0, len(pods))
+		for _, pod := range pods {
+			stats = append(stats, join.stats(c.newPodStats(pod), pod))
+		}
+		return page(stats, report.Unavailable)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Restarts.Prune(start)
+	if join != nil && join.stale > 0 {
+		report.Errors = append(report.Errors, c.staleError(join.stale, "pods"))
+	}
+	return report, nil
+}
+
+// namespaceSubtotals pod counts and usage of the pods in each namespace
+func namespaceSubtotals(pods []PodStats) []NamespaceStats {
+	subtotals := []NamespaceStats{}
+	for _, pod := range pods {
+		if len(subtotals) == 0 || subtotals[len(subtotals)-1].Name != pod.Namespace {
+			subtotals = append(subtotals, NamespaceStats{Name: pod.Namespace, CPUUsage: &resource.Quantity{}, MemoryUsage: &resource.Quantity{}})
+		}
+		subtotal := &subtotals[len(subtotals)-1]
+		subtotal.Pods++
+		if pod.Phase == typesv1.PodRunning {
+			subtotal.Running++
+		} else {
+			subtotal.Failing++
+		}
+		subtotal.Restarts += pod.Restarts
+		if pod.CPUUsage != nil {
+			subtotal.CPUUsage.Add(*pod.CPUUsage)
+		}
+		if pod.MemoryUsage != nil {
+			subtotal.MemoryUsage.Add(*pod.MemoryUsage)
+		}
+	}
+	return subtotals
+}
+
+// newPodStats state of the pod without its usage
+func (c *Collector) newPodStats(pod typesv1.Pod) PodStats {
+	stats := PodStats{
+		Name:            pod.Name,
+		Namespace:       pod.Namespace,
+		Node:            pod.Spec.NodeName,
+		Phase:           pod.Status.Phase,
+		Created:         pod.CreationTimestamp.Time,
+		TotalContainers: len(pod.Spec.Containers),
+		PodIP:           pod.Status.PodIP,
+		HostIP:          pod.Status.HostIP,
+		QOSClass:        pod.Status.QOSClass,
+		Owner:           podOwner(pod),
+		Labels:          pod.Labels,
+		Containers:      c.Restarts.containerRestarts(pod),
+	}
+	if pod.Status.StartTime != nil {
+		stats.StartTime = pod.Status.StartTime.Time
+	}
+	// pods that have not been scheduled yet have no container statuses
+	for _, status := range pod.Status.ContainerStatuses {
+		stats.Restarts += int(status.RestartCount)
+		if status.Ready {
+			stats.ReadyContainers++
+		}
+		stats.RecentRestarts += c.Restarts.RecentRestarts(pod, status)
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.FinishedAt.After(stats.LastRestart) {
+			stats.LastRestart = terminated.FinishedAt.Time
+		}
+		if c.Restarts.CrashLooping(pod, status) {
+			stats.CrashLooping = true
+		}
+	}
+	return stats
+}
+
+func podOwner(pod typesv1.Pod) string {
+	owner := v1.GetControllerOf(&pod)
+	if owner == nil {
+		return ""
+	}
+	return owner.Kind + "/" + owner.Name
+}
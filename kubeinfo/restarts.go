@@ -0,0 +1,123 @@
+package kubeinfo
+
+import (
+	"time"
+
+	typesv1 "k8s.io/api/core/v1"
+)
+
+const (
+	restartRateWindow = time.Hour
+	crashLoopReason   = "CrashLoopBackOff"
+)
+
+// restartSample restart count of a container observed at a refresh
+type restartSample struct {
+	Time       time.Time
+	Count      int32
+	FinishedAt time.Time
+}
+
+// RestartHistory restart samples per container gathered across watch refreshes
+type RestartHistory map[string][]restartSample
+
+func containerKey(pod typesv1.Pod, container string) string {
+	return pod.Namespace + "/" + pod.Name + "/" + container
+}
+
+// Record store the current restart counts and drop samples no longer needed for the rate window
+func (history RestartHistory) Record(pods []typesv1.Pod, now time.Time) {
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			key := containerKey(pod, status.Name)
+			sample := restartSample{Time: now, Count: status.RestartCount}
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				sample.FinishedAt = terminated.FinishedAt.Time
+			}
+			samples := append(history[key], sample)
+			// keep the newest sample older than the window as the baseline
+			for len(samples) > 1 && now.Sub(samples[1].Time) >= restartRateWindow {
+				samples = samples[1:]
+			}
+			history[key] = samples
+		}
+	}
+}
+
+// Prune drop the containers whose last restart count was recorded before since
+func (history RestartHistory) Prune(since time.Time) {
+	for key, samples := range history {
+		if samples[len(samples)-1].Time.Before(since) {
+			delete(history, key)
+		}
+	}
+}
+
+// RecentRestarts restarts within the rate window
+func (history RestartHistory) RecentRestarts(pod typesv1.Pod, status typesv1.ContainerStatus) int {
+	restarts := 0
+	if samples := history[containerKey(pod, status.Name)]; len(samples) > 0 {
+		restarts = int(status.RestartCount - samples[0].Count)
+	}
+	// without enough history at least count the last restart if it falls in the window
+	if terminated := status.LastTerminationState.Terminated; restarts == 0 && terminated != nil && status.RestartCount > 0 &&
+		time.Since(terminated.FinishedAt.Time) < restartRateWindow {
+		restarts = 1
+	}
+	return restarts
+}
+
+// CrashLooping kubelet is backing off the container or the gaps between observed restarts keep growing
+func (history RestartHistory) CrashLooping(pod typesv1.Pod, status typesv1.ContainerStatus) bool {
+	if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopReason {
+		return true
+	}
+	restarts := []time.Time{}
+	for i, sample := range history[containerKey(pod, status.Name)] {
+		if i == 0 || sample.Count != history[containerKey(pod, status.Name)][i-1].Count {
+			restarts = append(restarts, sample.FinishedAt)
+		}
+	}
+	if len(restarts) < 3 {
+		return false
+	}
+	last := len(restarts) - 1
+	return restarts[last].Sub(restarts[last-1]) > restarts[last-1].Sub(restarts[last-2])
+}
+
+// ContainerRestart restart details of a container that has restarted
+type ContainerRestart struct {
+	Pod            string
+	Container      string
+	Restarts       int32
+	RecentRestarts int
+	Reason         string
+	ExitCode       int32
+	Signal         int32
+	FinishedAt     time.Time
+	CrashLooping   bool
+}
+
+func (history RestartHistory) containerRestarts(pod typesv1.Pod) []ContainerRestart {
+	restarts := []ContainerRestart{}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.RestartCount == 0 {
+			continue
+		}
+		restart := ContainerRestart{
+			Pod:            pod.Name,
+			Container:      status.Name,
+			Restarts:       status.RestartCount,
+			RecentRestarts: history.RecentRestarts(pod, status),
+			CrashLooping:   history.CrashLooping(pod, status),
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			restart.Reason = terminated.Reason
+			restart.ExitCode = terminated.ExitCode
+			restart.Signal = terminated.Signal
+			restart.FinishedAt = terminated.FinishedAt.Time
+		}
+		restarts = append(restarts, restart)
+	}
+	return restarts
+}
@@ -0,0 +1,30 @@
+package kubeinfo
+
+import (
+	"testing"
+	"time"
+
+	typesv1 "k8s.io/api/core/v1"
+)
+
+func TestRestartHistoryPrune(t *testing.T) {
+	running := func(name string) typesv1.Pod {
+		pod := testPod("default", name, "app")
+		pod.Status.ContainerStatuses = []typesv1.ContainerStatus{{Name: "app", RestartCount: 1}}
+		return pod
+	}
+	history := RestartHistory{}
+	first := time.Now()
+	history.Record([]typesv1.Pod{running("web-1"), running("web-2")}, first)
+	history.Prune(first)
+	if len(history) != 2 {
+		t.Fatalf("history after the first refresh = %d containers, want 2", len(history))
+	}
+	// web-2 has gone by the second refresh
+	second := first.Add(15 * time.Second)
+	history.Record([]typesv1.Pod{running("web-1")}, second)
+	history.Prune(second)
+	if _, ok := history["default/web-2/app"]; ok || len(history) != 1 {
+		t.Errorf("history after the second refresh = %v, want only default/web-1/app", history)
+	}
+}
@@ -0,0 +1,277 @@
+package kubeinfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Default levels at which a container is at risk, throttling is the percentage of CFS periods the container was throttled in
+// and memory its working set against its limit
+const (
+	ThrottlingWarning   = 25
+	ThrottlingCritical  = 50
+	MemoryLimitWarning  = 80
+	MemoryLimitCritical = 90
+)
+
+// RiskThresholds levels at which a container is at risk, as percentages like the defaults
+type RiskThresholds struct {
+	ThrottlingWarning   float64
+	ThrottlingCritical  float64
+	MemoryLimitWarning  float64
+	MemoryLimitCritical float64
+}
+
+// DefaultRiskThresholds thresholds used unless others are configured
+func DefaultRiskThresholds() RiskThresholds {
+	return RiskThresholds{
+		ThrottlingWarning:   ThrottlingWarning,
+		ThrottlingCritical:  ThrottlingCritical,
+		MemoryLimitWarning:  MemoryLimitWarning,
+		MemoryLimitCritical: MemoryLimitCritical,
+	}
+}
+
+// ContainerRisk CPU throttling and memory use of a container against its limits
+type ContainerRisk struct {
+	Pod       string
+	Namespace string
+	Container string
+	Node      string
+	CPULimit  *resource.Quantity `json:",omitempty"`
+	// ThrottledPercent share of CFS periods the container was throttled in, since the previous refresh or since it started
+	ThrottledPercent *inf.Dec           `json:",omitempty"`
+	WorkingSet       *resource.Quantity `json:",omitempty"`
+	MemoryLimit      *resource.Quantity `json:",omitempty"`
+	MemoryPercent    *inf.Dec           `json:",omitempty"`
+	// Risks explanation of each risk found, most severe first
+	Risks []string
+	// score highest of the throttling and memory percentages, containers are ranked by it
+	score float64
+}
+
+// RiskReport result of collecting the risk view
+type RiskReport struct {
+	// Containers with a CPU or memory limit, most at risk first
+	Containers []ContainerRisk
+	// Errors non fatal failures, containers on nodes that could not be read are left out
+	Errors []error `json:"-"`
+}
+
+// cadvisorSample cumulative CFS periods and the working set of a container as cAdvisor reported them
+type cadvisorSample struct {
+	periods    float64
+	throttled  float64
+	hasPeriods bool
+	workingSet *uint64
+	// seen when a refresh read the sample
+	seen time.Time
+}
+
+// ThrottleHistory previous CFS period counts of each container, throttling is measured between refreshes
+type ThrottleHistory map[string]cadvisorSample
+
+// throttledPercent share of periods throttled since the previous sample of key, or since the container started
+func (h ThrottleHistory) throttledPercent(key string, sample cadvisorSample) *inf.Dec {
+	if !sample.hasPeriods {
+		return nil
+	}
+	previous, ok := h[key]
+	sample.seen = time.Now()
+	h[key] = sample
+	periods, throttled := sample.periods, sample.throttled
+	// counters reset when the container restarts
+	if ok && previous.hasPeriods && sample.periods > previous.periods && sample.throttled >= previous.throttled {
+		periods, throttled = sample.periods-previous.periods, sample.throttled-previous.throttled
+	}
+	if periods <= 0 {
+		return nil
+	}
+	return inf.NewDec(int64(throttled/periods*10000), 2)
+}
+
+// prune drop the containers whose sample was last read before since
+func (h ThrottleHistory) prune(since time.Time) {
+	for key, sample := range h {
+		if sample.seen.Before(since) {
+			delete(h, key)
+		}
+	}
+}
+
+// parseCadvisorMetrics container samples from kubelet cAdvisor metrics, keyed by namespace/pod/container.
+// Pod level cgroups and pause containers are left out.
+func parseCadvisorMetrics(data []byte) (map[string]cadvisorSample, error) {
+	samples := map[string]cadvisorSample{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// cAdvisor lines carry every label of the container and can be long
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "container_cpu_cfs_") && !strings.HasPrefix(line, "container_memory_working_set_bytes") {
+			continue
+		}
+		name, labels, value, _, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse kubelet cAdvisor metrics: %v", err)
+		}
+		container, pod := firstLabel(labels, "container", "container_name"), firstLabel(labels, "pod", "pod_name")
+		if container == "" || container == "POD" || pod == "" {
+			continue
+		}
+		key := labels["namespace"] + "/" + pod + "/" + container
+		sample := samples[key]
+		switch name {
+		case "container_cpu_cfs_periods_total":
+			sample.periods, sample.hasPeriods = value, true
+		case "container_cpu_cfs_throttled_periods_total":
+			sample.throttled = value
+		case "container_memory_working_set_bytes":
+			workingSet := uint64(value)
+			sample.workingSet = &workingSet
+		default:
+			continue
+		}
+		samples[key] = sample
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// wholePercent percentage rounded to a whole number for explanations
+func wholePercent(value *inf.Dec) string {
+	return new(inf.Dec).Round(value, 0, inf.RoundHalfUp).String()
+}
+
+// decFloat approximate value of a percentage for ranking
+func decFloat(value *inf.Dec) float64 {
+	if value == nil {
+		return 0
+	}
+	result, _ := strconv.ParseFloat(value.String(), 64)
+	return result
+}
+
+// explainRisks explanations of the risks of the container, critical before warning and memory before CPU at the same level
+func (risk *ContainerRisk) explainRisks(status *typesv1.ContainerStatus, thresholds RiskThresholds) {
+	memory, throttled := decFloat(risk.MemoryPercent), decFloat(risk.ThrottledPercent)
+	risk.score = memory
+	if throttled > memory {
+		risk.score = throttled
+	}
+	critical, warning := []string{}, []string{}
+	switch {
+	case memory >= thresholds.MemoryLimitCritical:
+		critical = append(critical, fmt.Sprintf("%s%% of memory limit, OOMKill likely", wholePercent(risk.MemoryPercent)))
+	case memory >= thresholds.MemoryLimitWarning:
+		warning = append(warning, fmt.Sprintf("%s%% of memory limit, close to OOMKill", wholePercent(risk.MemoryPercent)))
+	}
+	switch {
+	case throttled >= thresholds.ThrottlingCritical:
+		critical = append(critical, fmt.Sprintf("throttled in %s%% of CPU periods, CPU limit %s is too low", wholePercent(risk.ThrottledPercent), risk.CPULimit.String()))
+	case throttled >= thresholds.ThrottlingWarning:
+		warning = append(warning, fmt.Sprintf("throttled in %s%% of CPU periods, responses slow down", wholePercent(risk.ThrottledPercent)))
+	}
+	risk.Risks = append(critical, warning...)
+	if status != nil {
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason == "OOMKilled" {
+			risk.Risks = append(risk.Risks, "last restart was an OOMKill")
+		}
+	}
+}
+
+// Risks collect the CPU throttling and memory use against the limits of every container with a limit,
+// from the cAdvisor metrics of the kubelet of each node running the pods
+func (c *Collector) Risks() (*RiskReport, error) {
+	start := time.Now()
+	deadline := c.deadline(start)
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	report := &RiskReport{Containers: []ContainerRisk{}}
+	nodeNames, seen := []string{}, map[string]bool{}
+	for _, pod := range pods {
+		if pod.Status.Phase == typesv1.PodRunning && pod.Spec.NodeName != "" && !seen[pod.Spec.NodeName] {
+			seen[pod.Spec.NodeName] = true
+			nodeNames = append(nodeNames, pod.Spec.NodeName)
+		}
+	}
+	samples := map[string]cadvisorSample{}
+	for i, nodeName := range nodeNames {
+		if expired(deadline) {
+			report.Errors = append(report.Errors, fmt.Errorf("timed out after %s before reading the kubelets of %d nodes", c.RefreshTimeout, len(nodeNames)-i))
+			break
+		}
+		data, err := c.Source.KubeletCadvisor(nodeName)
+		if apierrors.IsForbidden(err) {
+			return nil, fmt.Errorf("%v\nthe risk view reads cAdvisor metrics from the kubelet of each node, which needs get nodes/proxy", err)
+		}
+		if err == nil {
+			var nodeSamples map[string]cadvisorSample
+			if nodeSamples, err = parseCadvisorMetrics(data); err == nil {
+				for key, sample := range nodeSamples {
+					samples[key] = sample
+				}
+				continue
+			}
+		}
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get cAdvisor metrics for node %s: %v", nodeName, err))
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase != typesv1.PodRunning {
+			continue
+		}
+		statuses := map[string]*typesv1.ContainerStatus{}
+		for i := range pod.Status.ContainerStatuses {
+			statuses[pod.Status.ContainerStatuses[i].Name] = &pod.Status.ContainerStatuses[i]
+		}
+		for _, container := range pod.Spec.Containers {
+			cpuLimit, hasCPU := container.Resources.Limits[typesv1.ResourceCPU]
+			memoryLimit, hasMemory := container.Resources.Limits[typesv1.ResourceMemory]
+			key := pod.Namespace + "/" + pod.Name + "/" + container.Name
+			sample, ok := samples[key]
+			if (!hasCPU && !hasMemory) || !ok {
+				continue
+			}
+			risk := ContainerRisk{Pod: pod.Name, Namespace: pod.Namespace, Container: container.Name, Node: pod.Spec.NodeName}
+			// containers without a CPU limit are never throttled, but the history is kept for when one is set
+			throttled := c.Throttling.throttledPercent(key, sample)
+			if hasCPU {
+				risk.CPULimit = &cpuLimit
+				risk.ThrottledPercent = throttled
+			}
+			if hasMemory {
+				risk.MemoryLimit = &memoryLimit
+				if risk.WorkingSet = bytesQuantity(sample.workingSet); risk.WorkingSet != nil {
+					risk.MemoryPercent = optionalPercentage(risk.WorkingSet, risk.MemoryLimit)
+				}
+			} else {
+				risk.WorkingSet = bytesQuantity(sample.workingSet)
+			}
+			risk.explainRisks(statuses[container.Name], c.RiskThresholds)
+			report.Containers = append(report.Containers, risk)
+		}
+	}
+	sort.SliceStable(report.Containers, func(i, j int) bool {
+		return report.Containers[i].score > report.Containers[j].score
+	})
+	c.Throttling.prune(start)
+	return report, nil
+}
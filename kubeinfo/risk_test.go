@@ -0,0 +1,38 @@
+package kubeinfo
+
+import (
+	"reflect"
+	"testing"
+
+	inf "gopkg.in/inf.v0"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestExplainRisks(t *testing.T) {
+	lowered := RiskThresholds{ThrottlingWarning: 10, ThrottlingCritical: 20, MemoryLimitWarning: 50, MemoryLimitCritical: 60}
+	tests := []struct {
+		name       string
+		thresholds RiskThresholds
+		want       []string
+	}{
+		{name: "defaults", thresholds: DefaultRiskThresholds(), want: []string{}},
+		{
+			name:       "configured",
+			thresholds: lowered,
+			want:       []string{"65% of memory limit, OOMKill likely", "throttled in 15% of CPU periods, responses slow down"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			risk := &ContainerRisk{
+				CPULimit:         resource.NewMilliQuantity(500, resource.DecimalSI),
+				ThrottledPercent: inf.NewDec(15, 0),
+				MemoryPercent:    inf.NewDec(65, 0),
+			}
+			risk.explainRisks(nil, test.thresholds)
+			if !reflect.DeepEqual(risk.Risks, test.want) {
+				t.Errorf("explainRisks() = %q, want %q", risk.Risks, test.want)
+			}
+		})
+	}
+}
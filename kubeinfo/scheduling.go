@@ -0,0 +1,287 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PendingPod explanation of why a pending pod has not been scheduled, or what a scheduled one waits on
+type PendingPod struct {
+	Name      string
+	Namespace string
+	// Node the pod is scheduled on, empty when it is not
+	Node string `json:",omitempty"`
+	// Reason and Message of the PodScheduled condition, or of the first waiting container of a scheduled pod
+	Reason        string
+	Message       string
+	UnboundClaims []string
+	FitNodes      int
+	NodeCount     int
+	// NodeFailures number of nodes failing for each reason
+	NodeFailures map[string]int
+	// NodeFitUnknown the pods of every namespace may not be listed, so the pod is not fitted against the nodes
+	NodeFitUnknown bool `json:",omitempty"`
+}
+
+// nodeCapacity allocatable resources of a node less what is already requested on it
+type nodeCapacity struct {
+	Node   typesv1.Node
+	CPU    *resource.Quantity
+	Memory *resource.Quantity
+	Pods   int64
+}
+
+func podRequests(pod typesv1.Pod) (*resource.Quantity, *resource.Quantity) {
+	cpu, memory := resource.Quantity{}, resource.Quantity{}
+	for _, container := range pod.Spec.Containers {
+		cpu.Add(*container.Resources.Requests.Cpu())
+		memory.Add(*container.Resources.Requests.Memory())
+	}
+	// init containers run one at a time so only the largest counts
+	for _, container := range pod.Spec.InitContainers {
+		if container.Resources.Requests.Cpu().Cmp(cpu) > 0 {
+			cpu = *container.Resources.Requests.Cpu()
+		}
+		if container.Resources.Requests.Memory().Cmp(memory) > 0 {
+			memory = *container.Resources.Requests.Memory()
+		}
+	}
+	return &cpu, &memory
+}
+
+func getNodeCapacities(nodes []typesv1.Node, pods []typesv1.Pod) []*nodeCapacity {
+	capacities := map[string]*nodeCapacity{}
+	result := []*nodeCapacity{}
+	for _, node := range nodes {
+		capacity := &nodeCapacity{
+			Node:   node,
+			CPU:    node.Status.Allocatable.Cpu().Copy(),
+			Memory: node.Status.Allocatable.Memory().Copy(),
+			Pods:   node.Status.Allocatable.Pods().Value(),
+		}
+		capacities[node.Name] = capacity
+		result = append(result, capacity)
+	}
+	for _, pod := range pods {
+		capacity, ok := capacities[pod.Spec.NodeName]
+		if !ok || pod.Status.Phase == typesv1.PodSucceeded || pod.Status.Phase == typesv1.PodFailed {
+			continue
+		}
+		cpu, memory := podRequests(pod)
+		capacity.CPU.Sub(*cpu)
+		capacity.Memory.Sub(*memory)
+		capacity.Pods--
+	}
+	return result
+}
+
+func nodeReady(node typesv1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == typesv1.NodeReady {
+			return condition.Status == typesv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeFitFailures reasons the pod cannot be placed on the node, empty when it fits
+func nodeFitFailures(pod typesv1.Pod, capacity *nodeCapacity) []string {
+	node := capacity.Node
+	failures := []string{}
+	if node.Spec.Unschedulable {
+		failures = append(failures, "unschedulable")
+	}
+	if !nodeReady(node) {
+		failures = append(failures, "not ready")
+	}
+	if len(pod.Spec.NodeSelector) > 0 && !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		failures = append(failures, "node selector mismatch")
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == typesv1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			failures = append(failures, fmt.Sprintf("untolerated taint %s", taint.ToString()))
+		}
+	}
+	cpu, memory := podRequests(pod)
+	if cpu.Cmp(*capacity.CPU) > 0 {
+		failures = append(failures, "insufficient cpu")
+	}
+	if memory.Cmp(*capacity.Memory) > 0 {
+		failures = append(failures, "insufficient memory")
+	}
+	if capacity.Pods < 1 {
+		failures = append(failures, "too many pods")
+	}
+	return failures
+}
+
+// unscheduled whether the pod still waits on the scheduler, rather than on its node pulling images or creating containers
+func unscheduled(pod typesv1.Pod) bool {
+	if pod.Spec.NodeName == "" {
+		return true
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == typesv1.PodScheduled && condition.Status == typesv1.ConditionFalse {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduledPendingPod what a pod already on a node is waiting on, its requests are already held on the node
+func scheduledPendingPod(pod typesv1.Pod) *PendingPod {
+	analysis := &PendingPod{Name: pod.Name, Namespace: pod.Namespace, Node: pod.Spec.NodeName}
+	statuses := append(append([]typesv1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			analysis.Reason, analysis.Message = waiting.Reason, waiting.Message
+			break
+		}
+	}
+	return analysis
+}
+
+// analysePendingPod fit the pod against the node capacities, nil capacities when unknown,
+// and check its claims unless claims is nil because they could not be listed
+func analysePendingPod(pod typesv1.Pod, capacities []*nodeCapacity, claims map[string]typesv1.PersistentVolumeClaim) *PendingPod {
+	analysis := &PendingPod{Name: pod.Name, Namespace: pod.Namespace, NodeCount: len(capacities), NodeFailures: map[string]int{}, NodeFitUnknown: capacities == nil}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == typesv1.PodScheduled {
+			analysis.Reason = condition.Reason
+			analysis.Message = condition.Message
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil || claims == nil {
+			continue
+		}
+		name := volume.PersistentVolumeClaim.ClaimName
+		if claim, ok := claims[pod.Namespace+"/"+name]; !ok || claim.Status.Phase != typesv1.ClaimBound {
+			analysis.UnboundClaims = append(analysis.UnboundClaims, name)
+		}
+	}
+	for _, capacity := range capacities {
+		failures := nodeFitFailures(pod, capacity)
+		if len(failures) == 0 {
+			analysis.FitNodes++
+		}
+		for _, failure := range failures {
+			analysis.NodeFailures[failure]++
+		}
+	}
+	return analysis
+}
+
+// NodeSummary scheduler style explanation e.g. "1/3 nodes fit; insufficient cpu(2)", or the node of a scheduled pod
+func (analysis *PendingPod) NodeSummary() string {
+	if analysis.Node != "" {
+		return "scheduled on " + analysis.Node
+	}
+	if analysis.NodeFitUnknown {
+		return "unknown, not allowed to list every pod"
+	}
+	failures := make([]string, 0, len(analysis.NodeFailures))
+	for failure := range analysis.NodeFailures {
+		failures = append(failures, failure)
+	}
+	sort.Strings(failures)
+	for i, failure := range failures {
+		failures[i] = fmt.Sprintf("%s(%d)", failure, analysis.NodeFailures[failure])
+	}
+	summary := fmt.Sprintf("%d/%d nodes fit", analysis.FitNodes, analysis.NodeCount)
+	if len(failures) > 0 {
+		summary += "; " + strings.Join(failures, ", ")
+	}
+	return summary
+}
+
+// pendingPods analyse every pending pod among the given pods that is not yet scheduled,
+// listing those already scheduled with what their containers wait on
+func (c *Collector) pendingPods(nodes []typesv1.Node, pods []typesv1.Pod) ([]*PendingPod, error) {
+	analyses, pending := []*PendingPod{}, []typesv1.Pod{}
+	for _, pod := range pods {
+		switch {
+		case pod.Status.Phase != typesv1.PodPending:
+		case unscheduled(pod):
+			pending = append(pending, pod)
+		default:
+			analyses = append(analyses, scheduledPendingPod(pod))
+		}
+	}
+	if len(pending) == 0 && len(analyses) == 0 {
+		return nil, nil
+	}
+	unscheduledAnalyses, err := c.analyseUnscheduled(nodes, pending)
+	if err != nil {
+		return nil, err
+	}
+	analyses = append(analyses, unscheduledAnalyses...)
+	sort.Slice(analyses, func(i, j int) bool { return analyses[i].Name < analyses[j].Name })
+	return analyses, nil
+}
+
+// analyseUnscheduled explain why each of the pods waiting on the scheduler does not fit the nodes.
+// Without access to every pod or to the claims, the PodScheduled condition is all that explains the pods.
+func (c *Collector) analyseUnscheduled(nodes []typesv1.Node, pending []typesv1.Pod) ([]*PendingPod, error) {
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	// node capacity has to account for every pod in every namespace
+	var capacities []*nodeCapacity
+	allPods, err := c.Source.Pods(v1.NamespaceAll, "")
+	if err == nil {
+		capacities = getNodeCapacities(nodes, allPods)
+	} else if !apierrors.IsForbidden(err) {
+		return nil, err
+	}
+	claims := map[string]typesv1.PersistentVolumeClaim{}
+	for _, namespace := range c.namespaces() {
+		claimList, err := c.Source.PersistentVolumeClaims(namespace)
+		if apierrors.IsForbidden(err) {
+			claims = nil
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, claim := range claimList {
+			claims[claim.Namespace+"/"+claim.Name] = claim
+		}
+	}
+	analyses := []*PendingPod{}
+	for _, pod := range pending {
+		analyses = append(analyses, analysePendingPod(pod, capacities, claims))
+	}
+	return analyses, nil
+}
+
+// Pending explain why each pending pod in the namespace has not been scheduled
+func (c *Collector) Pending() ([]*PendingPod, error) {
+	nodes, err := c.listNodes()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.pendingPods(nodes, pods)
+}
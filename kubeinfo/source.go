@@ -0,0 +1,291 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2beta1"
+	typesv1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	autoscalingv2beta1 "k8s.io/client-go/kubernetes/typed/autoscaling/v2beta1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	policyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
+)
+
+// Source provides the cluster objects a collector reports on
+type Source interface {
+	Nodes(selector string) ([]typesv1.Node, error)
+	Pods(namespace string, selector string) ([]typesv1.Pod, error)
+	// PodPages calls page with each page of the pods as it arrives, stopping at the first error page returns
+	PodPages(namespace string, selector string, page func(pods []typesv1.Pod) error) error
+	Events(namespace string, selector fields.Selector) ([]typesv1.Event, error)
+	PersistentVolumeClaims(namespace string) ([]typesv1.PersistentVolumeClaim, error)
+	PersistentVolumes() ([]typesv1.PersistentVolume, error)
+	HorizontalPodAutoscalers(namespace string) ([]autoscaling.HorizontalPodAutoscaler, error)
+	Deployments(namespace string) ([]apps.Deployment, error)
+	StatefulSets(namespace string) ([]apps.StatefulSet, error)
+	PodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error)
+	// WorkloadSelector label selector of the pods managed by a Deployment, StatefulSet, ReplicaSet or ReplicationController
+	WorkloadSelector(namespace string, kind string, name string) (labels.Selector, error)
+	KubeletSummary(nodeName string) (*KubeletSummary, error)
+	// KubeletCadvisor cAdvisor metrics of the containers on the node in Prometheus text format
+	KubeletCadvisor(nodeName string) ([]byte, error)
+	// AccessibleNamespaces namespaces the user may list pods in, the candidates are checked when namespaces cannot be listed
+	AccessibleNamespaces(candidates []string) ([]string, error)
+}
+
+// ClientSource reads objects from the API server
+type ClientSource struct {
+	Client        corev1.CoreV1Interface
+	Apps          appsv1.AppsV1Interface
+	Autoscaling   autoscalingv2beta1.AutoscalingV2beta1Interface
+	Policy        policyv1beta1.PolicyV1beta1Interface
+	Authorization authorizationv1.AuthorizationV1Interface
+	// PageSize items requested in each list call, zero lists everything at once
+	PageSize int64
+}
+
+// NewClientSource get source for the clientset
+func NewClientSource(client kubernetes.Interface) *ClientSource {
+	return &ClientSource{
+		Client:        client.CoreV1(),
+		Apps:          client.AppsV1(),
+		Autoscaling:   client.AutoscalingV2beta1(),
+		Policy:        client.PolicyV1beta1(),
+		Authorization: client.AuthorizationV1(),
+	}
+}
+
+// listPages call list with the options of each page until the API server returns no continue token.
+// Servers without paging return everything in the first page.
+func (s *ClientSource) listPages(options v1.ListOptions, list func(options v1.ListOptions) (string, error)) error {
+	options.Limit = s.PageSize
+	for {
+		next, err := list(options)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		options.Continue = next
+	}
+}
+
+// Nodes list nodes matching the label selector
+func (s *ClientSource) Nodes(selector string) ([]typesv1.Node, error) {
+	nodes := []typesv1.Node{}
+	err := s.listPages(v1.ListOptions{LabelSelector: selector}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Client.Nodes().List(options)
+		if err != nil {
+			return "", err
+		}
+		nodes = append(nodes, page.Items...)
+		return page.Continue, nil
+	})
+	return nodes, err
+}
+
+// Pods list pods in the namespace matching the label selector
+func (s *ClientSource) Pods(namespace string, selector string) ([]typesv1.Pod, error) {
+	pods := []typesv1.Pod{}
+	err := s.PodPages(namespace, selector, func(page []typesv1.Pod) error {
+		pods = append(pods, page...)
+		return nil
+	})
+	return pods, err
+}
+
+// PodPages list pods in the namespace matching the label selector a page at a time
+func (s *ClientSource) PodPages(namespace string, selector string, page func(pods []typesv1.Pod) error) error {
+	return s.listPages(v1.ListOptions{LabelSelector: selector}, func(options v1.ListOptions) (string, error) {
+		pods, err := s.Client.Pods(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		return pods.Continue, page(pods.Items)
+	})
+}
+
+// Events list events in the namespace matching the field selector
+func (s *ClientSource) Events(namespace string, selector fields.Selector) ([]typesv1.Event, error) {
+	events := []typesv1.Event{}
+	err := s.listPages(v1.ListOptions{FieldSelector: selector.String()}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Client.Events(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		events = append(events, page.Items...)
+		return page.Continue, nil
+	})
+	return events, err
+}
+
+// PersistentVolumeClaims list claims in the namespace
+func (s *ClientSource) PersistentVolumeClaims(namespace string) ([]typesv1.PersistentVolumeClaim, error) {
+	claims := []typesv1.PersistentVolumeClaim{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Client.PersistentVolumeClaims(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		claims = append(claims, page.Items...)
+		return page.Continue, nil
+	})
+	return claims, err
+}
+
+// PersistentVolumes list every persistent volume
+func (s *ClientSource) PersistentVolumes() ([]typesv1.PersistentVolume, error) {
+	volumes := []typesv1.PersistentVolume{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Client.PersistentVolumes().List(options)
+		if err != nil {
+			return "", err
+		}
+		volumes = append(volumes, page.Items...)
+		return page.Continue, nil
+	})
+	return volumes, err
+}
+
+// HorizontalPodAutoscalers list autoscalers in the namespace
+func (s *ClientSource) HorizontalPodAutoscalers(namespace string) ([]autoscaling.HorizontalPodAutoscaler, error) {
+	hpas := []autoscaling.HorizontalPodAutoscaler{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Autoscaling.HorizontalPodAutoscalers(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		hpas = append(hpas, page.Items...)
+		return page.Continue, nil
+	})
+	return hpas, err
+}
+
+// Deployments list deployments in the namespace
+func (s *ClientSource) Deployments(namespace string) ([]apps.Deployment, error) {
+	deployments := []apps.Deployment{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Apps.Deployments(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		deployments = append(deployments, page.Items...)
+		return page.Continue, nil
+	})
+	return deployments, err
+}
+
+// StatefulSets list stateful sets in the namespace
+func (s *ClientSource) StatefulSets(namespace string) ([]apps.StatefulSet, error) {
+	statefulSets := []apps.StatefulSet{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Apps.StatefulSets(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		statefulSets = append(statefulSets, page.Items...)
+		return page.Continue, nil
+	})
+	return statefulSets, err
+}
+
+// PodDisruptionBudgets list disruption budgets in the namespace
+func (s *ClientSource) PodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error) {
+	budgets := []policy.PodDisruptionBudget{}
+	err := s.listPages(v1.ListOptions{}, func(options v1.ListOptions) (string, error) {
+		page, err := s.Policy.PodDisruptionBudgets(namespace).List(options)
+		if err != nil {
+			return "", err
+		}
+		budgets = append(budgets, page.Items...)
+		return page.Continue, nil
+	})
+	return budgets, err
+}
+
+// WorkloadSelector label selector of the pods managed by a workload
+func (s *ClientSource) WorkloadSelector(namespace string, kind string, name string) (labels.Selector, error) {
+	var selector *v1.LabelSelector
+	switch kind {
+	case "Deployment":
+		deployment, err := s.Apps.Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = deployment.Spec.Selector
+	case "StatefulSet":
+		statefulSet, err := s.Apps.StatefulSets(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = statefulSet.Spec.Selector
+	case "ReplicaSet":
+		replicaSet, err := s.Apps.ReplicaSets(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = replicaSet.Spec.Selector
+	case "ReplicationController":
+		controller, err := s.Client.ReplicationControllers(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return labels.SelectorFromSet(controller.Spec.Selector), nil
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", kind)
+	}
+	return v1.LabelSelectorAsSelector(selector)
+}
+
+// KubeletSummary kubelet stats summary of the node
+func (s *ClientSource) KubeletSummary(nodeName string) (*KubeletSummary, error) {
+	return GetKubeletSummary(s.Client, nodeName)
+}
+
+// KubeletCadvisor cAdvisor metrics the kubelet of the node exposes
+func (s *ClientSource) KubeletCadvisor(nodeName string) ([]byte, error) {
+	return GetKubeletEndpoint(s.Client, nodeName, KubeletCadvisorMetrics)
+}
+
+// AccessibleNamespaces check which namespaces the user may list pods in
+func (s *ClientSource) AccessibleNamespaces(candidates []string) ([]string, error) {
+	names := candidates
+	namespaces, err := s.Client.Namespaces().List(v1.ListOptions{})
+	if err == nil {
+		names = []string{}
+		for _, namespace := range namespaces.Items {
+			names = append(names, namespace.Name)
+		}
+	} else if !apierrors.IsForbidden(err) {
+		return nil, err
+	}
+	checks := []AccessCheck{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			checks = append(checks, AccessCheck{Verb: "list", Resource: "pods", Namespace: name})
+		}
+	}
+	accessible := []string{}
+	for _, check := range CheckAccess(s.Authorization, checks) {
+		if check.Err != nil {
+			return nil, check.Err
+		}
+		if check.Allowed {
+			accessible = append(accessible, check.Namespace)
+		}
+	}
+	sort.Strings(accessible)
+	return accessible, nil
+}
@@ -0,0 +1,194 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+
+	typesv1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// WorkloadSpread where the ready replicas of a Deployment or StatefulSet are running
+type WorkloadSpread struct {
+	Kind          string
+	Name          string
+	Namespace     string
+	Replicas      int32
+	ReadyReplicas int
+	// Nodes and Zones ready replicas on each node and in each zone
+	Nodes map[string]int
+	Zones map[string]int
+	// DisruptionBudget name of the PodDisruptionBudget covering the pods, empty if there is none
+	DisruptionBudget string
+	Flags            []string
+}
+
+// SpreadReport result of collecting the workload spread view
+type SpreadReport struct {
+	Workloads []WorkloadSpread
+	// Unavailable data the user may not read, zones are unknown without nodes
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, affected workloads are left out
+	Errors []error `json:"-"`
+}
+
+// workloadTemplate fields shared by Deployments and StatefulSets
+type workloadTemplate struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Replicas  *int32
+	Selector  *v1.LabelSelector
+	Labels    map[string]string
+}
+
+func podReady(pod typesv1.Pod) bool {
+	if pod.Status.Phase != typesv1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == typesv1.PodReady {
+			return condition.Status == typesv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func disruptionBudget(budgets []policy.PodDisruptionBudget, namespace string, podLabels map[string]string) string {
+	for _, budget := range budgets {
+		if budget.Namespace != namespace || budget.Spec.Selector == nil {
+			continue
+		}
+		selector, err := v1.LabelSelectorAsSelector(budget.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(podLabels)) {
+			return budget.Name
+		}
+	}
+	return ""
+}
+
+// spreadFlags single points of failure, zones are only checked when the cluster spans more than one
+func spreadFlags(spread WorkloadSpread, clusterZones int) []string {
+	flags := []string{}
+	if spread.ReadyReplicas > 1 && len(spread.Nodes) == 1 {
+		flags = append(flags, "All replicas on one node")
+	}
+	if spread.ReadyReplicas > 1 && clusterZones > 1 && len(spread.Zones) == 1 {
+		flags = append(flags, "All replicas in one zone")
+	}
+	if spread.Replicas == 1 && spread.DisruptionBudget == "" {
+		flags = append(flags, "Single replica without PodDisruptionBudget")
+	}
+	return flags
+}
+
+func (c *Collector) workloadTemplates() ([]workloadTemplate, error) {
+	templates := []workloadTemplate{}
+	for _, namespace := range c.namespaces() {
+		deployments, err := c.Source.Deployments(namespace)
+		if err != nil {
+			return nil, err
+		}
+		statefulSets, err := c.Source.StatefulSets(namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deployments {
+			templates = append(templates, workloadTemplate{"Deployment", deployment.Name, deployment.Namespace,
+				deployment.Spec.Replicas, deployment.Spec.Selector, deployment.Spec.Template.Labels})
+		}
+		for _, statefulSet := range statefulSets {
+			templates = append(templates, workloadTemplate{"StatefulSet", statefulSet.Name, statefulSet.Namespace,
+				statefulSet.Spec.Replicas, statefulSet.Spec.Selector, statefulSet.Spec.Template.Labels})
+		}
+	}
+	return templates, nil
+}
+
+func (c *Collector) listDisruptionBudgets() ([]policy.PodDisruptionBudget, error) {
+	budgets := []policy.PodDisruptionBudget{}
+	for _, namespace := range c.namespaces() {
+		items, err := c.Source.PodDisruptionBudgets(namespace)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, items...)
+	}
+	return budgets, nil
+}
+
+// Spread collect how the ready replicas of every Deployment and StatefulSet in the namespace are spread across nodes and zones
+func (c *Collector) Spread() (*SpreadReport, error) {
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := c.workloadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	report := &SpreadReport{}
+	zones := map[string]string{}
+	clusterZones := map[string]bool{}
+	nodes, err := c.listNodes()
+	if apierrors.IsForbidden(err) {
+		report.Unavailable = append(report.Unavailable, UnavailableNodes)
+	} else if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to list nodes, zones are unknown: %v", err))
+	}
+	for _, node := range nodes {
+		zones[node.Name] = NodeZone(node)
+		if zones[node.Name] != "" {
+			clusterZones[zones[node.Name]] = true
+		}
+	}
+	budgets, err := c.listDisruptionBudgets()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to list pod disruption budgets: %v", err))
+	}
+
+	for _, template := range templates {
+		selector, err := v1.LabelSelectorAsSelector(template.Selector)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("invalid selector for %s %s: %v", template.Kind, template.Name, err))
+			continue
+		}
+		spread := WorkloadSpread{
+			Kind:             template.Kind,
+			Name:             template.Name,
+			Namespace:        template.Namespace,
+			Replicas:         1,
+			Nodes:            map[string]int{},
+			Zones:            map[string]int{},
+			DisruptionBudget: disruptionBudget(budgets, template.Namespace, template.Labels),
+		}
+		if template.Replicas != nil {
+			spread.Replicas = *template.Replicas
+		}
+		for _, pod := range pods {
+			if pod.Namespace != template.Namespace || !selector.Matches(labels.Set(pod.Labels)) || !podReady(pod) {
+				continue
+			}
+			spread.ReadyReplicas++
+			spread.Nodes[pod.Spec.NodeName]++
+			if zone := zones[pod.Spec.NodeName]; zone != "" {
+				spread.Zones[zone]++
+			}
+		}
+		spread.Flags = spreadFlags(spread, len(clusterZones))
+		report.Workloads = append(report.Workloads, spread)
+	}
+	sort.Slice(report.Workloads, func(i, j int) bool {
+		if report.Workloads[i].Namespace != report.Workloads[j].Namespace {
+			return report.Workloads[i].Namespace < report.Workloads[j].Namespace
+		}
+		return report.Workloads[i].Name < report.Workloads[j].Name
+	})
+	return report, nil
+}
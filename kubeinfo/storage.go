@@ -0,0 +1,179 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	betaStorageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+)
+
+var accessModeNames = map[typesv1.PersistentVolumeAccessMode]string{
+	typesv1.ReadWriteOnce: "RWO",
+	typesv1.ReadOnlyMany:  "ROX",
+	typesv1.ReadWriteMany: "RWX",
+}
+
+// ClaimStats state and usage of a persistent volume claim
+type ClaimStats struct {
+	Name         string
+	Namespace    string
+	Phase        typesv1.PersistentVolumeClaimPhase
+	Requested    *resource.Quantity
+	Volume       string
+	StorageClass string
+	AccessModes  []typesv1.PersistentVolumeAccessMode
+	// Used and UsedPercent are only set when the kubelet reports volume stats
+	Used        *resource.Quantity
+	UsedPercent *inf.Dec
+	Pods        []string
+}
+
+// UnclaimedVolume persistent volume that is available or released
+type UnclaimedVolume struct {
+	Name          string
+	Phase         typesv1.PersistentVolumePhase
+	Capacity      *resource.Quantity
+	StorageClass  string
+	ReclaimPolicy typesv1.PersistentVolumeReclaimPolicy
+	Created       time.Time
+}
+
+// StorageReport result of collecting the storage view
+type StorageReport struct {
+	Claims    []ClaimStats
+	Unclaimed []UnclaimedVolume
+	// Unavailable data the user may not read, volume usage needs the kubelet through nodes/proxy
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, affected values are left out
+	Errors []error `json:"-"`
+}
+
+func claimStorageClass(claim typesv1.PersistentVolumeClaim) string {
+	if claim.Spec.StorageClassName != nil {
+		return *claim.Spec.StorageClassName
+	}
+	return claim.Annotations[betaStorageClassAnnotation]
+}
+
+// AccessModesString short form of access modes e.g. "RWO,ROX"
+func AccessModesString(modes []typesv1.PersistentVolumeAccessMode) string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = accessModeNames[mode]
+	}
+	return strings.Join(names, ",")
+}
+
+// volumeUsage kubelet volume stats for the given nodes keyed by claim namespace and name
+func (c *Collector) volumeUsage(nodeNames map[string]bool, report *StorageReport) map[string]KubeletVolumeStats {
+	usage := map[string]KubeletVolumeStats{}
+	for nodeName := range nodeNames {
+		summary, err := c.Source.KubeletSummary(nodeName)
+		if apierrors.IsForbidden(err) {
+			report.Unavailable = append(report.Unavailable, UnavailableKubelet)
+			return usage
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to get volume stats for node %s: %v", nodeName, err))
+			continue
+		}
+		for _, pod := range summary.Pods {
+			for _, volume := range pod.VolumeStats {
+				if volume.PVCRef != nil {
+					usage[volume.PVCRef.Namespace+"/"+volume.PVCRef.Name] = volume
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// Storage collect persistent volume claims in the namespace and the volumes not bound to any claim
+func (c *Collector) Storage() (*StorageReport, error) {
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	claims := []typesv1.PersistentVolumeClaim{}
+	for _, namespace := range c.namespaces() {
+		items, err := c.Source.PersistentVolumeClaims(namespace)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, items...)
+	}
+	report := &StorageReport{}
+	claimPods := map[string][]string{}
+	claimNodes := map[string]bool{}
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			key := pod.Namespace + "/" + volume.PersistentVolumeClaim.ClaimName
+			claimPods[key] = append(claimPods[key], pod.Name)
+			if pod.Spec.NodeName != "" {
+				claimNodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	usage := c.volumeUsage(claimNodes, report)
+
+	for _, claim := range claims {
+		key := claim.Namespace + "/" + claim.Name
+		requested := claim.Spec.Resources.Requests[typesv1.ResourceStorage]
+		stats := ClaimStats{
+			Name:         claim.Name,
+			Namespace:    claim.Namespace,
+			Phase:        claim.Status.Phase,
+			Requested:    &requested,
+			Volume:       claim.Spec.VolumeName,
+			StorageClass: claimStorageClass(claim),
+			AccessModes:  claim.Spec.AccessModes,
+			Pods:         claimPods[key],
+		}
+		if volume, ok := usage[key]; ok && volume.UsedBytes != nil {
+			stats.Used = bytesQuantity(volume.UsedBytes)
+			if volume.CapacityBytes != nil && *volume.CapacityBytes > 0 {
+				stats.UsedPercent = percentage(stats.Used, bytesQuantity(volume.CapacityBytes))
+			}
+		}
+		report.Claims = append(report.Claims, stats)
+	}
+	sort.Slice(report.Claims, func(i, j int) bool { return report.Claims[i].Name < report.Claims[j].Name })
+
+	volumes, err := c.Source.PersistentVolumes()
+	if apierrors.IsForbidden(err) {
+		report.Unavailable = append(report.Unavailable, UnavailableVolumes)
+		return report, nil
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("failed to get persistent volumes: %v", err))
+		return report, nil
+	}
+	for _, volume := range volumes {
+		if volume.Status.Phase != typesv1.VolumeAvailable && volume.Status.Phase != typesv1.VolumeReleased {
+			continue
+		}
+		capacity := volume.Spec.Capacity[typesv1.ResourceStorage]
+		report.Unclaimed = append(report.Unclaimed, UnclaimedVolume{
+			Name:          volume.Name,
+			Phase:         volume.Status.Phase,
+			Capacity:      &capacity,
+			StorageClass:  volume.Spec.StorageClassName,
+			ReclaimPolicy: volume.Spec.PersistentVolumeReclaimPolicy,
+			Created:       volume.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(report.Unclaimed, func(i, j int) bool { return report.Unclaimed[i].Name < report.Unclaimed[j].Name })
+	return report, nil
+}
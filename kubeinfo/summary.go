@@ -0,0 +1,229 @@
+package kubeinfo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	inf "gopkg.in/inf.v0"
+	typesv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// ClusterSummary totals across the nodes and every pod in the cluster, or the pods collected when not all may be listed
+type ClusterSummary struct {
+	Nodes             int
+	NodeStates        map[string]int
+	CPUAllocatable    *resource.Quantity
+	CPUUsage          *resource.Quantity
+	MemoryAllocatable *resource.Quantity
+	MemoryUsage       *resource.Quantity
+	// CPUPercent and MemoryPercent node usage against allocatable
+	CPUPercent    *inf.Dec
+	MemoryPercent *inf.Dec
+	// PodScope pods the pod totals cover when not every pod in the cluster, e.g. "namespace default"
+	PodScope  string `json:",omitempty"`
+	Pods      int
+	PodPhases map[typesv1.PodPhase]int
+	Restarts  int
+	Failing   int
+	// PodCPUUsage and PodMemoryUsage usage of the pods, compared against their requests
+	PodCPUUsage           *resource.Quantity
+	PodMemoryUsage        *resource.Quantity
+	CPURequests           *resource.Quantity
+	MemoryRequests        *resource.Quantity
+	CPURequestsPercent    *inf.Dec
+	MemoryRequestsPercent *inf.Dec
+	// Unavailable data the user may not read, node totals are unknown without nodes
+	Unavailable []string `json:",omitempty"`
+	// Errors non fatal failures, affected usage totals are left at zero
+	Errors []error `json:"-"`
+}
+
+// optionalPercentage percentage of second, nil when second is zero
+func optionalPercentage(first *resource.Quantity, second *resource.Quantity) *inf.Dec {
+	if second.IsZero() {
+		return nil
+	}
+	return percentage(first, second)
+}
+
+// podScope pods collected, as the summary describes them when it cannot cover every pod
+func (c *Collector) podScope() string {
+	namespaces := "every namespace"
+	switch {
+	case c.AccessibleNamespaces != nil:
+		namespaces = "namespaces " + strings.Join(c.AccessibleNamespaces, ", ")
+	case c.Namespace != v1.NamespaceAll:
+		namespaces = "namespace " + c.Namespace
+	}
+	if c.LabelSelector != "" {
+		return "matching " + c.LabelSelector + " in " + namespaces
+	}
+	return namespaces
+}
+
+// clusterPods every pod in the cluster for the summary, or the pods collected with their scope when not all may be listed.
+// Metrics of the pods collected are only kept when those are every pod.
+func (c *Collector) clusterPods(pods []typesv1.Pod, podMetrics *metricsapi.PodMetricsList) ([]typesv1.Pod, *metricsapi.PodMetricsList, string, error) {
+	if c.Namespace == v1.NamespaceAll && c.AccessibleNamespaces == nil && c.LabelSelector == "" {
+		return pods, podMetrics, "", nil
+	}
+	// namespaces are only narrowed down when every pod may not be listed
+	if c.AccessibleNamespaces != nil {
+		return pods, podMetrics, c.podScope(), nil
+	}
+	allPods, err := c.Source.Pods(v1.NamespaceAll, "")
+	if apierrors.IsForbidden(err) {
+		return pods, podMetrics, c.podScope(), nil
+	}
+	if err != nil {
+		return pods, podMetrics, c.podScope(), fmt.Errorf("failed to list every pod for the summary: %v", err)
+	}
+	return allPods, nil, "", nil
+}
+
+// summarise totals for the nodes and every pod, nodeMetrics and podMetrics are fetched when nil
+func (c *Collector) summarise(nodes []typesv1.Node, pods []typesv1.Pod, nodeMetrics *metricsapi.NodeMetricsList, podMetrics *metricsapi.PodMetricsList) *ClusterSummary {
+	pods, podMetrics, scope, podsErr := c.clusterPods(pods, podMetrics)
+	summary := &ClusterSummary{
+		Nodes:             len(nodes),
+		NodeStates:        map[string]int{},
+		CPUAllocatable:    &resource.Quantity{},
+		CPUUsage:          &resource.Quantity{},
+		MemoryAllocatable: &resource.Quantity{},
+		MemoryUsage:       &resource.Quantity{},
+		PodScope:          scope,
+		Pods:              len(pods),
+		PodPhases:         map[typesv1.PodPhase]int{},
+		PodCPUUsage:       &resource.Quantity{},
+		PodMemoryUsage:    &resource.Quantity{},
+		CPURequests:       &resource.Quantity{},
+		MemoryRequests:    &resource.Quantity{},
+	}
+	if podsErr != nil {
+		summary.Errors = append(summary.Errors, podsErr)
+	}
+	names := map[string]bool{}
+	for _, node := range nodes {
+		names[node.Name] = true
+		summary.NodeStates[nodeState(node)]++
+		summary.CPUAllocatable.Add(*node.Status.Allocatable.Cpu())
+		summary.MemoryAllocatable.Add(*node.Status.Allocatable.Memory())
+	}
+	// without nodes, as when they cannot be listed, there is no node usage to total
+	var err error
+	unmeasured := 0
+	if nodeMetrics == nil && len(nodes) > 0 {
+		nodeMetrics, err = c.Metrics.GetNodeMetrics("", labels.Everything().String())
+	}
+	if err != nil {
+		summary.Errors = append(summary.Errors, fmt.Errorf("failed to get node metrics for the summary: %v", err))
+	} else if nodeMetrics != nil {
+		now := time.Now()
+		for _, metric := range nodeMetrics.Items {
+			if !names[metric.Name] || c.excluded(c.metricSample(metric.Timestamp, metric.Window, now)) {
+				continue
+			}
+			if cpu := resourceUsage(metric.Usage, typesv1.ResourceCPU); cpu != nil {
+				summary.CPUUsage.Add(*cpu)
+			} else {
+				unmeasured++
+			}
+			summary.MemoryUsage.Add(*metric.Usage.Memory())
+		}
+		if unmeasured > 0 {
+			summary.Errors = append(summary.Errors, unmeasuredError(unmeasured, "nodes"))
+		}
+	}
+	// a percentage of the nodes measured so far would read as low usage
+	if unmeasured == 0 {
+		summary.CPUPercent = optionalPercentage(summary.CPUUsage, summary.CPUAllocatable)
+	}
+	summary.MemoryPercent = optionalPercentage(summary.MemoryUsage, summary.MemoryAllocatable)
+
+	// metrics read from kubectl top output may not have a namespace
+	scheduled, scheduledNames := map[string]bool{}, map[string]bool{}
+	for _, pod := range pods {
+		summary.PodPhases[pod.Status.Phase]++
+		if pod.Status.Phase != typesv1.PodRunning {
+			summary.Failing++
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			summary.Restarts += int(status.RestartCount)
+		}
+		// unscheduled pods do not hold their requests yet, finished pods no longer do
+		if pod.Spec.NodeName == "" || pod.Status.Phase == typesv1.PodSucceeded || pod.Status.Phase == typesv1.PodFailed {
+			continue
+		}
+		scheduled[pod.Namespace+"/"+pod.Name] = true
+		scheduledNames[pod.Name] = true
+		cpu, memory := podRequests(pod)
+		summary.CPURequests.Add(*cpu)
+		summary.MemoryRequests.Add(*memory)
+	}
+	var metricsErr error
+	switch {
+	case podMetrics != nil:
+	case scope == "":
+		podMetrics, metricsErr = c.Metrics.GetPodMetrics(v1.NamespaceAll, "", true, labels.Everything())
+	default:
+		var selector labels.Selector
+		if selector, metricsErr = labels.Parse(c.LabelSelector); metricsErr == nil {
+			podMetrics, metricsErr = c.listPodMetrics(selector)
+		}
+	}
+	if metricsErr != nil {
+		summary.Errors = append(summary.Errors, fmt.Errorf("failed to get pod metrics for the summary: %v", metricsErr))
+		podMetrics = &metricsapi.PodMetricsList{}
+	}
+	now := time.Now()
+	unmeasured = 0
+	for _, metric := range podMetrics.Items {
+		if !scheduled[metric.Namespace+"/"+metric.Name] && !(metric.Namespace == "" && scheduledNames[metric.Name]) {
+			continue
+		}
+		if c.excluded(c.metricSample(metric.Timestamp, metric.Window, now)) {
+			continue
+		}
+		var cpu *resource.Quantity
+		for _, container := range metric.Containers {
+			cpu = addUsage(cpu, container.Usage, typesv1.ResourceCPU)
+			summary.PodMemoryUsage.Add(*container.Usage.Memory())
+		}
+		if cpu == nil {
+			unmeasured++
+		} else {
+			summary.PodCPUUsage.Add(*cpu)
+		}
+	}
+	if unmeasured > 0 {
+		summary.Errors = append(summary.Errors, unmeasuredError(unmeasured, "pods"))
+	}
+	if unmeasured == 0 {
+		summary.CPURequestsPercent = optionalPercentage(summary.PodCPUUsage, summary.CPURequests)
+	}
+	summary.MemoryRequestsPercent = optionalPercentage(summary.PodMemoryUsage, summary.MemoryRequests)
+	return summary
+}
+
+// Summary collect cluster wide node and pod totals, pod totals only cover the namespace when not every pod may be listed
+func (c *Collector) Summary() (*ClusterSummary, error) {
+	pods, err := c.listPods(c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := c.listNodes()
+	if err != nil && !apierrors.IsForbidden(err) {
+		return nil, err
+	}
+	summary := c.summarise(nodes, pods, nil, nil)
+	if err != nil {
+		summary.Unavailable = append(summary.Unavailable, UnavailableNodes)
+	}
+	return summary, nil
+}
@@ -1,205 +1,359 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
-	"sort"
-	"strconv"
+	"strings"
 	"time"
 
-	typesv1 "k8s.io/api/core/v1"
+	"github.com/marc-harry/k8s-info/kubeinfo"
+	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
-	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // Default Constants
 const (
 	DefaultNamespace = "default"
+	DefaultCommand   = "nodes"
 )
 
 // KubeInfoService basic information service
 type KubeInfoService struct {
-	Client        corev1.CoreV1Interface
-	MetricClient  *HeapsterMetricsClient
+	Collector       *kubeinfo.Collector
+	namespacesNoted bool
+}
+
+// globalOptions flags shared by every command, named after their kubectl equivalents
+type globalOptions struct {
+	Kubeconfig string
+	Context    string
+	Cluster    string
+	User       string
+	// Server, Token, CertificateAuthority and InsecureSkipTLSVerify connection settings applied over the kubeconfig
+	Server                string
+	Token                 string
+	CertificateAuthority  string
+	InsecureSkipTLSVerify bool
+	// As and AsGroups user and groups to impersonate
+	As            string
+	AsGroups      []string
 	Namespace     string
 	AllNamespaces bool
-	Metric        string
+	Selector      string
+	Output        string
+	Watch         bool
+	Duration      int
+	FromFile      string
+	Profile       string
+	SortBy        string
+	Columns       []string
+	LabelColumns  []string
+	// RequestTimeout, QPS and Burst limits of the API client
+	RequestTimeout time.Duration
+	QPS            float32
+	Burst          int
+	// RefreshTimeout deadline for collecting each refresh
+	RefreshTimeout time.Duration
+	// MetricsSource where node and pod usage is read from, one of the metricsSource constants
+	MetricsSource string
+	// ChunkSize items requested in each list call, 0 lists everything at once
+	ChunkSize int64
+	// StaleAfter age at which node and pod metrics are flagged as stale, 0 never
+	StaleAfter time.Duration
+	// ExcludeStale leave stale usage out of the tables and totals
+	ExcludeStale bool
+	// ShowMetricAge add the age of the metrics sample to the nodes and pods tables
+	ShowMetricAge bool
 }
 
-func main() {
-	home := homeDir()
-	kubeconfig := flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	watch := flag.Bool("watch", false, "(optional) watch at intervals 15 second by default")
-	namespaceFlag := flag.String("namespace", DefaultNamespace, "(optional) get resources in particular namespace")
-	duration := flag.Int("duration", 15, "(optional) set watch interval to custom duration in seconds")
-	all := flag.Bool("all", false, "(optional) get all namespaces (this will override --namespace)")
-	metric := flag.String("metric", "nodes", "(required) Metric {nodes|pods};.")
-	flag.Parse()
+// defaultChunkSize items in each list call by default, as kubectl uses
+const defaultChunkSize = 500
 
-	namespace := *namespaceFlag
-	durationSeconds := *duration
+// defaultStaleAfter age of a metrics sample flagged as stale by default, several times the usual resolution of the metrics pipeline
+const defaultStaleAfter = 3 * time.Minute
 
-	if *all {
-		namespace = ""
-	}
+// Sources of node and pod usage
+const (
+	metricsHeapster       = "heapster"
+	metricsKubelet        = "kubelet"
+	metricsKubeletSummary = "kubelet-summary"
+)
 
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		panic(err.Error())
-	}
+func (options *globalOptions) flagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("k8s-info", pflag.ExitOnError)
+	flags.StringVar(&options.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file, defaults to the files listed in KUBECONFIG merged, or ~/.kube/config")
+	flags.StringVar(&options.Context, "context", "", "kubeconfig context to use, defaults to the current context")
+	flags.StringVar(&options.Cluster, "cluster", "", "kubeconfig cluster to use instead of the one of the context")
+	flags.StringVar(&options.User, "user", "", "kubeconfig user to use instead of the one of the context")
+	flags.StringVar(&options.Server, "server", "", "address of the API server, overrides the kubeconfig")
+	flags.StringVar(&options.Token, "token", "", "bearer token to authenticate with, overrides the kubeconfig")
+	flags.StringVar(&options.CertificateAuthority, "certificate-authority", "", "path to a CA certificate file for the API server")
+	flags.BoolVar(&options.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "do not check the certificate of the API server, which makes connections insecure")
+	flags.StringVar(&options.As, "as", "", "user to impersonate")
+	flags.StringSliceVar(&options.AsGroups, "as-group", nil, "group to impersonate, may be repeated")
+	flags.DurationVar(&options.RequestTimeout, "request-timeout", 0, "time to wait for each API call, 0 waits as long as the refresh timeout")
+	flags.Float32Var(&options.QPS, "qps", rest.DefaultQPS, "maximum API calls per second")
+	flags.IntVar(&options.Burst, "burst", rest.DefaultBurst, "maximum burst of API calls above --qps")
+	flags.DurationVar(&options.RefreshTimeout, "refresh-timeout", time.Minute, "deadline for collecting each refresh, rows still waiting on metrics are shown as timed out, 0 for none")
+	flags.Int64Var(&options.ChunkSize, "chunk-size", defaultChunkSize, "list large collections in chunks of this many items rather than all at once, 0 to disable")
+	flags.StringVar(&options.MetricsSource, "metrics-source", metricsHeapster, "where node and pod usage is read from {heapster|kubelet|kubelet-summary}, kubelet reads /metrics/resource of each node")
+	flags.DurationVar(&options.StaleAfter, "stale-after", defaultStaleAfter, "age at which node and pod metrics are flagged as stale, as when a kubelet stops reporting, 0 never, off with --from-file unless given")
+	flags.BoolVar(&options.ExcludeStale, "exclude-stale", false, "leave stale metrics out of usage and totals rather than only flagging them")
+	flags.BoolVar(&options.ShowMetricAge, "show-metric-age", false, "show the age and window of the metrics sample in the nodes and pods tables")
+	flags.StringVarP(&options.Namespace, "namespace", "n", "", "namespace to get resources from, defaults to the namespace of the context")
+	flags.BoolVarP(&options.AllNamespaces, "all-namespaces", "A", false, "get resources from all namespaces (overrides --namespace)")
+	flags.StringVarP(&options.Selector, "selector", "l", "", "label selector to filter pods on")
+	flags.StringVarP(&options.Output, "output", "o", formatTable, "output format {table|json|csv|custom-columns=HEADER:column,...}")
+	flags.BoolVarP(&options.Watch, "watch", "w", false, "refresh at intervals, 15 seconds by default")
+	flags.IntVar(&options.Duration, "duration", 15, "watch interval in seconds")
+	flags.StringVar(&options.FromFile, "from-file", "", "comma separated kubectl JSON or top output files to read instead of a cluster")
+	flags.StringVar(&options.Profile, "profile", "", "named profile from the config file to use")
+	flags.StringVar(&options.SortBy, "sort-by", "", "column to sort the table on")
+	flags.StringSliceVar(&options.Columns, "columns", nil, "comma separated columns to show, see the help of each command for those available")
+	flags.StringSliceVarP(&options.LabelColumns, "label-columns", "L", nil, "label keys to show as extra columns in the nodes and pods tables")
+	return flags
+}
 
-	client, err := kubernetes.NewForConfig(config)
+func main() {
+	options := &globalOptions{}
+	globalFlags := options.flagSet()
+	globalFlags.SetInterspersed(false)
+	commands := newCommands()
+	globalFlags.Usage = usage(commands, globalFlags)
+	globalFlags.Parse(os.Args[1:])
+	settings, err := loadConfig(options.Profile)
 	if err != nil {
-		panic(err.Error())
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	metricClient := DefaultHeapsterMetricsClient(client.CoreV1())
-
-	service := &KubeInfoService{
-		Client:        client.CoreV1(),
-		MetricClient:  metricClient,
-		Namespace:     namespace,
-		AllNamespaces: *all,
-		Metric:        *metric,
+	name, args := DefaultCommand, globalFlags.Args()
+	if settings.Command != "" {
+		name = settings.Command
 	}
-	if *watch {
-		for {
-			processRequest(service)
-			time.Sleep(time.Second * time.Duration(durationSeconds))
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		if len(args) > 0 && findCommand(commands, args[0]) != nil {
+			commandUsage(findCommand(commands, args[0]), globalFlags)()
+		} else {
+			globalFlags.Usage()
 		}
-	} else {
-		processRequest(service)
+		return
+	}
+	cmd := findCommand(commands, name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		globalFlags.Usage()
+		os.Exit(2)
+	}
+	flags := pflag.NewFlagSet(cmd.Name, pflag.ExitOnError)
+	flags.AddFlagSet(cmd.Flags)
+	flags.AddFlagSet(globalFlags)
+	flags.Usage = commandUsage(cmd, globalFlags)
+	profileName := options.Profile
+	flags.Parse(args)
+	if options.Profile != profileName {
+		if settings, err = loadConfig(options.Profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	settings.apply(globalFlags)
+	tableColumns, tableSort, labelColumns = map[string][]string{}, map[string]string{}, options.LabelColumns
+	for view, columns := range settings.Columns {
+		tableColumns[view] = columns
+	}
+	for view, column := range settings.Sort {
+		tableSort[view] = column
+	}
+	if options.SortBy != "" {
+		tableSort[cmd.Name] = options.SortBy
+	}
+	if len(options.Columns) > 0 {
+		tableColumns[cmd.Name] = options.Columns
 	}
-}
 
-func processRequest(service *KubeInfoService) {
-	switch service.Metric {
-	case "nodes":
-		getNodeStatuses(service)
-	case "pods":
-		getPodStatuses(service)
+	switch {
+	case options.Output == formatTable, options.Output == formatJSON, options.Output == formatCSV:
+		outputFormat = options.Output
+	case strings.HasPrefix(options.Output, formatCustomColumns):
+		outputFormat = formatTable
+		tableColumns[cmd.Name] = strings.Split(strings.TrimPrefix(options.Output, formatCustomColumns), ",")
 	default:
-		fmt.Println("Invalid metric supplied.")
+		fmt.Fprintf(os.Stderr, "Invalid output format %q\n", options.Output)
+		os.Exit(2)
+	}
+	colourEnabled = outputFormat == formatTable && colourSupported()
+	colourThresholds.merge(settings.Thresholds)
+	if err := validateColumns(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if options.ShowMetricAge {
+		for _, view := range []string{"nodes", "pods"} {
+			showColumn(view, "metric-age")
+			showColumn(view, "metric-window")
+		}
+	}
+
+	if cmd.RunOptions != nil {
+		if err := cmd.RunOptions(options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	service, err := newService(options, globalFlags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if options.Watch {
+		if options.Duration < 1 {
+			fmt.Fprintln(os.Stderr, "--duration must be at least 1 second")
+			os.Exit(2)
+		}
+		watch(service, cmd, time.Second*time.Duration(options.Duration))
+	} else {
+		processRequest(service, cmd)
+	}
 }
 
-func getPodStatuses(service *KubeInfoService) {
-	pods, err := service.Client.Pods(service.Namespace).List(v1.ListOptions{})
-	if err != nil {
-		panic(err.Error())
+// clientConfig kubeconfig loaded like kubectl: --kubeconfig, otherwise the files in KUBECONFIG merged,
+// otherwise ~/.kube/config, with the context, cluster, user and connection flags applied over it
+func (options *globalOptions) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = options.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: options.Context,
+		Context: clientcmdapi.Context{
+			Cluster:  options.Cluster,
+			AuthInfo: options.User,
+		},
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:                options.Server,
+			CertificateAuthority:  options.CertificateAuthority,
+			InsecureSkipTLSVerify: options.InsecureSkipTLSVerify,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Token:             options.Token,
+			Impersonate:       options.As,
+			ImpersonateGroups: options.AsGroups,
+		},
 	}
-	data := [][]string{}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
 
-	stats := make(chan []string)
-	statCount := len(pods.Items)
-	for _, pod := range pods.Items {
-		go getPodStats(stats, pod, service)
+// applyLimits set the timeout and rate limits of the API client, no single call outlasts the refresh timeout
+func (options *globalOptions) applyLimits(config *rest.Config) {
+	config.Timeout = options.RequestTimeout
+	if config.Timeout == 0 {
+		config.Timeout = options.RefreshTimeout
 	}
+	config.QPS = options.QPS
+	config.Burst = options.Burst
+}
 
-	outputInfo := [][]string{}
-	for statCount != len(data) {
-		data = append(data, <-stats)
+func newService(options *globalOptions, flags *pflag.FlagSet) (*KubeInfoService, error) {
+	namespaceSet := flags.Changed("namespace")
+	collectorOptions := kubeinfo.Options{
+		Namespace:      options.Namespace,
+		AllNamespaces:  options.AllNamespaces,
+		LabelSelector:  options.Selector,
+		RefreshTimeout: options.RefreshTimeout,
+		PageSize:       options.ChunkSize,
+		StaleAfter:     options.StaleAfter,
+		ExcludeStale:   options.ExcludeStale,
+		RiskThresholds: riskThresholds(),
+		// an explicit namespace is an error when forbidden, otherwise show what the user can access
+		DiscoverNamespaces: options.AllNamespaces || !namespaceSet,
 	}
-	for _, val := range data {
-		if val != nil {
-			outputInfo = append(outputInfo, val)
+	if options.FromFile != "" {
+		source, err := kubeinfo.NewFileSource(strings.Split(options.FromFile, ",")...)
+		if err != nil {
+			return nil, err
+		}
+		if !namespaceSet {
+			collectorOptions.Namespace = DefaultNamespace
 		}
+		// a dump is as old as when it was taken, its metrics are only stale against an age asked for
+		if !flags.Changed("stale-after") {
+			collectorOptions.StaleAfter = 0
+		}
+		collectorOptions.Metrics = source
+		return &KubeInfoService{Collector: kubeinfo.NewSourceCollector(source, collectorOptions)}, nil
 	}
-	sort.Sort(byName(outputInfo))
-	headers := []string{"Pod", "Node", "CPU Usage", "CPU %", "Mem Usage", "Mem %", "Status", "Up time", "Restarts", "Last Restart"}
-	outputData(headers, outputInfo)
-}
 
-func getNodeStatuses(service *KubeInfoService) {
-	nodes, err := service.Client.Nodes().List(v1.ListOptions{})
+	clientConfig := options.clientConfig()
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	pods, err := service.Client.Pods(service.Namespace).List(v1.ListOptions{})
-	if err != nil {
-		panic(err.Error())
-	}
-	nodePods := map[string][]string{}
-	failingPods := map[string]typesv1.PodPhase{}
-	for _, pod := range pods.Items {
-		nodePods[pod.Spec.NodeName] = append(nodePods[pod.Spec.NodeName], pod.Name)
-		if pod.Status.Phase != typesv1.PodRunning {
-			failingPods[pod.Name] = pod.Status.Phase
+	if !namespaceSet {
+		// like kubectl fall back to the namespace of the context
+		if collectorOptions.Namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, err
 		}
 	}
-	data := [][]string{}
-	for _, node := range nodes.Items {
-		metrics, err := service.MetricClient.GetNodeMetrics(node.Name, labels.Everything().String())
-		if err != nil {
-			fmt.Printf("Failed to get metrics for Node: %s\n", node.Name)
-			continue
-		}
-		nodeState := ""
-		for _, condition := range node.Status.Conditions {
-			if condition.Type == "Ready" {
-				switch condition.Status {
-				case "True":
-					nodeState = "Ready"
-				case "False":
-					nodeState = "Not Ready"
-				case "Unknown":
-					nodeState = "Unknown"
-				}
-			}
+	if raw, err := clientConfig.RawConfig(); err == nil {
+		for _, context := range raw.Contexts {
+			collectorOptions.CandidateNamespaces = append(collectorOptions.CandidateNamespaces, context.Namespace)
 		}
+	}
+	collectorOptions.CandidateNamespaces = append(collectorOptions.CandidateNamespaces, collectorOptions.Namespace, DefaultNamespace)
 
-		for _, metric := range metrics.Items {
-			memoryUsage := metric.Usage.Memory()
-			allocMemory := node.Status.Allocatable.Memory()
-			cpuUsage := metric.Usage.Cpu()
-			allocCPU := node.Status.Allocatable.Cpu()
-			memoryPer := getPercentage(memoryUsage, allocMemory)
-			cpuPer := getPercentage(cpuUsage, allocCPU)
-			podCount := len(nodePods[node.Name])
+	options.applyLimits(config)
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if collectorOptions.Metrics, err = options.metricsSource(client); err != nil {
+		return nil, err
+	}
+	return &KubeInfoService{Collector: kubeinfo.NewCollector(client, collectorOptions)}, nil
+}
 
-			data = append(data, []string{node.Name, asString(cpuUsage), asString(cpuPer), asString(memoryUsage), asString(memoryPer), strconv.Itoa(podCount), nodeState})
+// metricsSource client for the --metrics-source, kept by the collector so kubelet CPU rates span refreshes
+func (options *globalOptions) metricsSource(client kubernetes.Interface) (kubeinfo.MetricsSource, error) {
+	switch options.MetricsSource {
+	case metricsHeapster:
+		return kubeinfo.DefaultHeapsterMetricsClient(client.CoreV1()), nil
+	case metricsKubelet, metricsKubeletSummary:
+		endpoint := kubeinfo.KubeletResourceMetrics
+		if options.MetricsSource == metricsKubeletSummary {
+			endpoint = kubeinfo.KubeletStatsSummary
 		}
+		kubelet := kubeinfo.NewKubeletMetricsClient(client.CoreV1(), endpoint)
+		kubelet.PageSize = options.ChunkSize
+		return kubelet, nil
 	}
-	headers := []string{"Node", "CPU Usage", "CPU %", "Mem Usage", "Mem %", "Pod Count", "State"}
-	outputData(headers, data)
-	if len(failingPods) > 0 {
-		outputFailing(failingPods)
+	return nil, fmt.Errorf("unknown metrics source %q, use heapster, kubelet or kubelet-summary", options.MetricsSource)
+}
+
+func processRequest(service *KubeInfoService, cmd *command) {
+	if err := cmd.Run(service); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	service.noteNamespaces()
 }
 
-func getPodStats(stats chan<- []string, pod typesv1.Pod, service *KubeInfoService) {
-	metrics, err := service.MetricClient.GetPodMetrics(service.Namespace, pod.Name, service.AllNamespaces, labels.Everything())
-	if err != nil {
-		fmt.Printf("Failed to get logs for Pod: %s\n", pod.Name)
-		stats <- nil
+// noteNamespaces say once which namespaces were shown after the requested scope was forbidden
+func (service *KubeInfoService) noteNamespaces() {
+	if service.namespacesNoted || service.Collector.AccessibleNamespaces == nil {
 		return
 	}
-	node, err := service.Client.Nodes().Get(pod.Spec.NodeName, v1.GetOptions{})
-	if err != nil {
-		panic(err.Error())
-	}
-	for _, metric := range metrics.Items {
-		memoryUsage := metric.Containers[0].Usage.Memory()
-		allocMemory := node.Status.Allocatable.Memory()
-		cpuUsage := metric.Containers[0].Usage.Cpu()
-		allocCPU := node.Status.Allocatable.Cpu()
-		memoryPer := getPercentage(memoryUsage, allocMemory)
-		cpuPer := getPercentage(cpuUsage, allocCPU)
-		restartsCount := int(pod.Status.ContainerStatuses[0].RestartCount)
-
-		upTime := getTimeSince(pod.Status.StartTime.Time)
-		lastRestart := ""
-		if restartsCount > 0 {
-			lastRestart = getTimeSince(pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt.Time)
-		}
-		stats <- []string{pod.Name, pod.Spec.NodeName, asString(cpuUsage), asString(cpuPer), asString(memoryUsage),
-			asString(memoryPer), asString(pod.Status.Phase), upTime, strconv.Itoa(restartsCount), lastRestart}
+	service.namespacesNoted = true
+	scope := "namespace " + service.Collector.Namespace
+	if service.Collector.Namespace == v1.NamespaceAll {
+		scope = "all namespaces"
 	}
+	fmt.Fprintf(os.Stderr, "not allowed to list pods in %s, showing the namespaces you can access: %s\n",
+		scope, strings.Join(service.Collector.AccessibleNamespaces, ", "))
 }
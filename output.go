@@ -1,16 +1,74 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/marc-harry/k8s-info/kubeinfo"
 	"github.com/olekukonko/tablewriter"
+	inf "gopkg.in/inf.v0"
 	typesv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
-func outputData(headers []string, data [][]string) {
-	fmt.Printf("Kubernetes Stats at: %s\n", time.Now())
+// Output formats
+const (
+	formatTable         = "table"
+	formatJSON          = "json"
+	formatCSV           = "csv"
+	formatCustomColumns = "custom-columns="
+)
+
+// staleMarker follows the usage and metric age of samples older than --stale-after
+const staleMarker = "stale"
+
+var (
+	outputFormat = formatTable
+	// tableColumns names of the columns to show, by view
+	tableColumns map[string][]string
+	// tableSort name of the column to sort on, by view
+	tableSort map[string]string
+	// labelColumns label keys shown as extra columns in the nodes and pods tables
+	labelColumns []string
+	// collapseGroups leave out the member nodes of grouped nodes
+	collapseGroups bool
+	// redrawScreen clear the terminal before each report, set when watching on a terminal
+	redrawScreen bool
+)
+
+// outputReport print non fatal errors to stderr, then the report as JSON or through its table renderer
+func outputReport(report interface{}, errs []error, render func()) {
+	if redrawScreen {
+		fmt.Print(clearScreen)
+	}
+	outputErrors(errs)
+	if outputFormat == formatJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+	render()
+}
+
+func outputTable(title string, headers []string, data [][]string) {
+	if outputFormat == formatCSV {
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write(headers)
+		writer.WriteAll(data)
+		fmt.Println()
+		return
+	}
+	fmt.Printf("%s at: %s\n", title, time.Now())
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader(headers)
 	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
@@ -20,17 +78,500 @@ func outputData(headers []string, data [][]string) {
 	fmt.Println()
 }
 
-func outputFailing(dataMap map[string]typesv1.PodPhase) {
+// outputRows sort the rows and print the columns chosen for the view
+func outputRows(view string, title string, rows []tableRow) {
+	sortRows(view, rows, tableSort[view])
+	renderRows(view, title, rows)
+}
+
+// renderRows print the columns chosen for the view in the order of the rows
+func renderRows(view string, title string, rows []tableRow) {
+	columns := selectedColumns(view)
+	headers := []string{}
+	for _, col := range columns {
+		headers = append(headers, col.Header)
+	}
 	data := [][]string{}
-	for podName, podInfo := range dataMap {
-		data = append(data, []string{podName, asString(podInfo)})
+	for _, row := range rows {
+		cells := []string{}
+		for _, col := range columns {
+			cells = append(cells, colourCell(col, row[col.Name]))
+		}
+		data = append(data, cells)
 	}
-	fmt.Printf("Failing Pod Stats at: %s\n", time.Now())
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Pod", "Status"})
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
-	table.AppendBulk(data)
-	table.Render()
-	fmt.Println()
+	outputTable(title, headers, data)
+}
+
+func outputData(view string, rows []tableRow) {
+	outputRows(view, "Kubernetes Stats", rows)
+}
+
+func outputFailing(failing []kubeinfo.FailingPod) {
+	rows := []tableRow{}
+	for _, pod := range failing {
+		rows = append(rows, tableRow{"pod": pod.Name, "namespace": pod.Namespace, "status": asString(pod.Phase), "warnings": pod.Events.Summary()})
+	}
+	outputRows("failing", "Failing Pod Stats", rows)
+}
+
+func outputErrors(errs []error) {
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func optionalString(value interface{}, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return asString(value)
+}
+
+func yesOrEmpty(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return ""
+}
+
+// countsString counts in the order of the keys, leaving out those that are zero
+func countsString(keys []string, counts map[string]int) string {
+	parts := []string{}
+	for _, key := range keys {
+		if counts[key] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", key, counts[key]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// unavailable whether the report could not read data because RBAC forbids it
+func unavailable(unavailable []string, data string) bool {
+	for _, value := range unavailable {
+		if value == data {
+			return true
+		}
+	}
+	return false
+}
+
+func usageString(usage *resource.Quantity, total *resource.Quantity, percent *inf.Dec, of string) string {
+	return fmt.Sprintf("%s of %s %s (%s%%)", asString(usage), asString(total), of, optionalString(percent, percent != nil))
+}
+
+// outputSummary print the cluster totals as a block of text, there is no summary in CSV output
+func outputSummary(summary *kubeinfo.ClusterSummary) {
+	if summary == nil || outputFormat == formatCSV {
+		return
+	}
+	nodeStates := []string{}
+	for state := range summary.NodeStates {
+		nodeStates = append(nodeStates, state)
+	}
+	sort.Strings(nodeStates)
+	phases := map[string]int{}
+	for phase, count := range summary.PodPhases {
+		phases[string(phase)] = count
+	}
+	phaseOrder := []string{string(typesv1.PodRunning), string(typesv1.PodPending), string(typesv1.PodSucceeded),
+		string(typesv1.PodFailed), string(typesv1.PodUnknown)}
+
+	// pod totals cover every pod unless some may not be listed, then they say which
+	pods, scope := "pods", ""
+	if summary.PodScope != "" {
+		pods, scope = "pods "+summary.PodScope, " "+summary.PodScope
+	}
+	fmt.Printf("Cluster Summary at: %s\n", time.Now())
+	if unavailable(summary.Unavailable, kubeinfo.UnavailableNodes) {
+		// node totals are unknown, only the pods collected can be summed
+		fmt.Printf("  Nodes:     unknown, not allowed to list nodes\n")
+		fmt.Printf("  CPU:       %s %s\n", pods, usageString(summary.PodCPUUsage, summary.CPURequests, summary.CPURequestsPercent, "requested"))
+		fmt.Printf("  Memory:    %s %s\n", pods, usageString(summary.PodMemoryUsage, summary.MemoryRequests, summary.MemoryRequestsPercent, "requested"))
+	} else {
+		fmt.Printf("  Nodes:     %d (%s)\n", summary.Nodes, countsString(nodeStates, summary.NodeStates))
+		fmt.Printf("  CPU:       %s, %s %s\n", usageString(summary.CPUUsage, summary.CPUAllocatable, summary.CPUPercent, "allocatable"),
+			pods, usageString(summary.PodCPUUsage, summary.CPURequests, summary.CPURequestsPercent, "requested"))
+		fmt.Printf("  Memory:    %s, %s %s\n", usageString(summary.MemoryUsage, summary.MemoryAllocatable, summary.MemoryPercent, "allocatable"),
+			pods, usageString(summary.PodMemoryUsage, summary.MemoryRequests, summary.MemoryRequestsPercent, "requested"))
+	}
+	fmt.Printf("  Pods:      %d%s (%s)\n", summary.Pods, scope, countsString(phaseOrder, phases))
+	fmt.Printf("  Restarts:  %d\n", summary.Restarts)
+	fmt.Printf("  Failing:   %d\n\n", summary.Failing)
+}
+
+// addKubeletUsage set the kubelet stats columns of a node or pod row, cells stay empty when a value is unknown
+func addKubeletUsage(row tableRow, usage *kubeinfo.KubeletUsage) {
+	if usage == nil {
+		return
+	}
+	row["rx"] = optionalString(usage.NetworkRx, usage.NetworkRx != nil)
+	row["tx"] = optionalString(usage.NetworkTx, usage.NetworkTx != nil)
+	row["rootfs"] = optionalString(usage.RootFsUsed, usage.RootFsUsed != nil)
+	row["rootfs%"] = optionalString(usage.RootFsPercent, usage.RootFsPercent != nil)
+	row["imagefs"] = optionalString(usage.ImageFsUsed, usage.ImageFsUsed != nil)
+	row["imagefs%"] = optionalString(usage.ImageFsPercent, usage.ImageFsPercent != nil)
+	row["ephemeral"] = optionalString(usage.EphemeralUsed, usage.EphemeralUsed != nil)
+	row["ephemeral-limit"] = optionalString(usage.EphemeralLimit, usage.EphemeralLimit != nil)
+	row["ephemeral%"] = optionalString(usage.EphemeralPercent, usage.EphemeralPercent != nil)
+	row["working-set"] = optionalString(usage.WorkingSet, usage.WorkingSet != nil)
+	row["rss"] = optionalString(usage.RSS, usage.RSS != nil)
+}
+
+// markTimedOut show the usage of a row as timed out, its metrics did not arrive before the refresh deadline
+func markTimedOut(row tableRow) {
+	row["cpu"] = "timed out"
+	row["mem"] = "timed out"
+}
+
+// addMetricSample fill the metric age and window, flagging the usage of a stale sample
+func addMetricSample(row tableRow, sample *kubeinfo.MetricSample) {
+	if sample == nil {
+		return
+	}
+	row["metric-age"] = getTimeSince(sample.Timestamp)
+	row["metric-window"] = optionalString(formatDuration(sample.Window), sample.Window > 0)
+	if !sample.Stale {
+		return
+	}
+	row["metric-age"] += " " + staleMarker
+	for _, name := range []string{"cpu", "mem"} {
+		// usage of an excluded sample is left empty
+		row[name] = strings.TrimSpace(row[name] + " " + staleMarker)
+	}
+}
+
+func outputNodes(report *kubeinfo.NodeReport) {
+	outputSummary(report.Summary)
+	dropUnavailable("nodes", report.Unavailable)
+	rows := []tableRow{}
+	for _, node := range report.Nodes {
+		row := addLabels(tableRow{
+			"node":      node.Name,
+			"cpu":       optionalString(node.CPUUsage, node.CPUUsage != nil),
+			"cpu%":      optionalString(node.CPUPercent, node.CPUPercent != nil),
+			"cpu-alloc": asString(node.CPUAllocatable),
+			"mem-alloc": asString(node.MemoryAllocatable),
+			"mem":       optionalString(node.MemoryUsage, node.MemoryUsage != nil),
+			"mem%":      optionalString(node.MemoryPercent, node.MemoryPercent != nil),
+			"pods":      strconv.Itoa(node.PodCount),
+			"state":     node.State,
+			"warnings":  node.Events.Summary(),
+			"zone":      node.Zone,
+			"kubelet":   node.KubeletVersion,
+			"ip":        node.InternalIP,
+			"age":       optionalString(getTimeSince(node.Created), !node.Created.IsZero()),
+		}, node.Labels)
+		if node.TimedOut {
+			markTimedOut(row)
+		}
+		addMetricSample(row, node.MetricSample)
+		addKubeletUsage(row, node.Kubelet)
+		rows = append(rows, row)
+	}
+	if report.Groups != nil {
+		outputNodeGroups(report.Groups, rows)
+	} else {
+		outputData("nodes", rows)
+	}
+	if len(report.Failing) > 0 {
+		outputFailing(report.Failing)
+	}
+	if len(report.Pending) > 0 {
+		outputPending(report.Pending)
+	}
+}
+
+// outputNodeGroups print a row per group, followed by the rows of its member nodes unless collapsed
+func outputNodeGroups(groups []kubeinfo.NodeGroup, nodeRows []tableRow) {
+	members := map[string]tableRow{}
+	for _, row := range nodeRows {
+		members[row["node"]] = row
+	}
+	groupRows := []tableRow{}
+	groupMembers := map[string][]tableRow{}
+	for _, group := range groups {
+		name := group.Label + "=" + group.Value
+		groupRows = append(groupRows, tableRow{
+			"group":     name,
+			"nodes":     strconv.Itoa(group.NodeCount),
+			"cpu":       asString(group.CPUUsage),
+			"cpu-alloc": asString(group.CPUAllocatable),
+			"cpu%":      optionalString(group.CPUPercent, group.CPUPercent != nil),
+			"mem":       asString(group.MemoryUsage),
+			"mem-alloc": asString(group.MemoryAllocatable),
+			"mem%":      optionalString(group.MemoryPercent, group.MemoryPercent != nil),
+			"pods":      strconv.Itoa(group.PodCount),
+		})
+		for _, member := range group.Members {
+			row := tableRow{"group": "  " + member}
+			for key, value := range members[member] {
+				if key != "node" {
+					row[key] = value
+				}
+			}
+			groupMembers[name] = append(groupMembers[name], row)
+		}
+	}
+	sortRows("nodegroups", groupRows, tableSort["nodegroups"])
+	rows := []tableRow{}
+	for _, row := range groupRows {
+		rows = append(rows, row)
+		if !collapseGroups {
+			sortRows("nodegroups", groupMembers[row["group"]], tableSort["nodegroups"])
+			rows = append(rows, groupMembers[row["group"]]...)
+		}
+	}
+	renderRows("nodegroups", "Node Group Stats", rows)
+}
+
+func outputFailingReport(report *kubeinfo.FailingReport) {
+	dropUnavailable("failing", report.Unavailable)
+	outputFailing(report.Failing)
+	if len(report.Pending) > 0 {
+		outputPending(report.Pending)
+	}
+}
+
+func outputNamespaces(report *kubeinfo.NamespaceReport) {
+	outputData("namespaces", namespaceRows(report.Namespaces))
+}
+
+func namespaceRows(namespaces []kubeinfo.NamespaceStats) []tableRow {
+	rows := []tableRow{}
+	for _, namespace := range namespaces {
+		rows = append(rows, tableRow{
+			"namespace": namespace.Name,
+			"pods":      strconv.Itoa(namespace.Pods),
+			"running":   strconv.Itoa(namespace.Running),
+			"failing":   strconv.Itoa(namespace.Failing),
+			"restarts":  strconv.Itoa(namespace.Restarts),
+			"cpu":       asString(namespace.CPUUsage),
+			"mem":       asString(namespace.MemoryUsage),
+		})
+	}
+	return rows
+}
+
+func outputPods(report *kubeinfo.PodReport) {
+	dropUnavailable("pods", report.Unavailable)
+	if report.Namespaces != nil {
+		showColumn("pods", "namespace")
+	}
+	outputSummary(report.Summary)
+	rows := []tableRow{}
+	restarts := []tableRow{}
+	for _, pod := range report.Pods {
+		rows = append(rows, podRow(pod))
+		restarts = append(restarts, containerRestartRows(pod.Containers)...)
+	}
+	outputData("pods", rows)
+	if report.Namespaces != nil {
+		outputRows("namespaces", "Namespace Subtotals", namespaceRows(report.Namespaces))
+	}
+	if len(restarts) > 0 {
+		outputData("containers", restarts)
+	}
+}
+
+// podRow cells of a pod in the pods table
+func podRow(pod kubeinfo.PodStats) tableRow {
+	row := addLabels(tableRow{
+		"pod":          pod.Name,
+		"namespace":    pod.Namespace,
+		"node":         pod.Node,
+		"cpu":          optionalString(pod.CPUUsage, pod.CPUUsage != nil),
+		"cpu%":         optionalString(pod.CPUPercent, pod.CPUPercent != nil),
+		"mem":          optionalString(pod.MemoryUsage, pod.MemoryUsage != nil),
+		"mem%":         optionalString(pod.MemoryPercent, pod.MemoryPercent != nil),
+		"status":       asString(pod.Phase),
+		"uptime":       optionalString(getTimeSince(pod.StartTime), !pod.StartTime.IsZero()),
+		"restarts":     strconv.Itoa(pod.Restarts),
+		"restarts-1h":  strconv.Itoa(pod.RecentRestarts),
+		"last-restart": optionalString(getTimeSince(pod.LastRestart), pod.Restarts > 0 && !pod.LastRestart.IsZero()),
+		"crash-loop":   yesOrEmpty(pod.CrashLooping),
+		"ready":        fmt.Sprintf("%d/%d", pod.ReadyContainers, pod.TotalContainers),
+		"age":          optionalString(getTimeSince(pod.Created), !pod.Created.IsZero()),
+		"ip":           pod.PodIP,
+		"host-ip":      pod.HostIP,
+		"qos":          asString(pod.QOSClass),
+		"owner":        pod.Owner,
+	}, pod.Labels)
+	if pod.TimedOut {
+		markTimedOut(row)
+	}
+	addMetricSample(row, pod.MetricSample)
+	addKubeletUsage(row, pod.Kubelet)
+	return row
+}
+
+func containerRestartRows(containers []kubeinfo.ContainerRestart) []tableRow {
+	rows := []tableRow{}
+	for _, container := range containers {
+		terminated := !container.FinishedAt.IsZero()
+		rows = append(rows, tableRow{
+			"pod":          container.Pod,
+			"container":    container.Container,
+			"restarts":     strconv.Itoa(int(container.Restarts)),
+			"restarts-1h":  strconv.Itoa(container.RecentRestarts),
+			"reason":       container.Reason,
+			"exit-code":    optionalString(strconv.Itoa(int(container.ExitCode)), terminated),
+			"signal":       optionalString(strconv.Itoa(int(container.Signal)), container.Signal != 0),
+			"last-restart": optionalString(getTimeSince(container.FinishedAt), terminated),
+			"crash-loop":   yesOrEmpty(container.CrashLooping),
+		})
+	}
+	return rows
+}
+
+func outputEvents(groups []*kubeinfo.EventGroup) {
+	rows := []tableRow{}
+	for _, group := range groups {
+		rows = append(rows, tableRow{
+			"object":    group.Name,
+			"kind":      group.Kind,
+			"namespace": group.Namespace,
+			"reasons":   group.Summary(),
+			"count":     strconv.Itoa(int(group.Count)),
+			"last-seen": getTimeSince(group.LastSeen),
+			"message":   group.Message,
+		})
+	}
+	outputData("events", rows)
+}
+
+func outputStorage(report *kubeinfo.StorageReport) {
+	dropUnavailable("storage", report.Unavailable)
+	rows := []tableRow{}
+	for _, claim := range report.Claims {
+		rows = append(rows, tableRow{
+			"claim":         claim.Name,
+			"namespace":     claim.Namespace,
+			"status":        asString(claim.Phase),
+			"requested":     asString(claim.Requested),
+			"volume":        claim.Volume,
+			"storage-class": claim.StorageClass,
+			"access-modes":  kubeinfo.AccessModesString(claim.AccessModes),
+			"used":          optionalString(claim.Used, claim.Used != nil),
+			"used%":         optionalString(claim.UsedPercent, claim.UsedPercent != nil),
+			"pods":          strings.Join(claim.Pods, ", "),
+		})
+	}
+	outputData("storage", rows)
+	if len(report.Unclaimed) > 0 {
+		rows = []tableRow{}
+		for _, volume := range report.Unclaimed {
+			rows = append(rows, tableRow{
+				"volume":         volume.Name,
+				"status":         asString(volume.Phase),
+				"capacity":       asString(volume.Capacity),
+				"storage-class":  volume.StorageClass,
+				"reclaim-policy": asString(volume.ReclaimPolicy),
+				"age":            getTimeSince(volume.Created),
+			})
+		}
+		outputData("volumes", rows)
+	}
+}
+
+func outputPending(pending []*kubeinfo.PendingPod) {
+	rows := []tableRow{}
+	for _, pod := range pending {
+		rows = append(rows, tableRow{
+			"pod":            pod.Name,
+			"reason":         pod.Reason,
+			"message":        pod.Message,
+			"unbound-claims": strings.Join(pod.UnboundClaims, ", "),
+			"node-fit":       pod.NodeSummary(),
+		})
+	}
+	outputData("pending", rows)
+}
+
+func outputHPAs(report *kubeinfo.HPAReport) {
+	rows := []tableRow{}
+	for _, hpa := range report.HPAs {
+		current, target := "-", "-"
+		if hpa.CurrentCPU != nil {
+			current = strconv.Itoa(int(*hpa.CurrentCPU))
+		}
+		if hpa.TargetCPU != nil {
+			target = strconv.Itoa(int(*hpa.TargetCPU))
+		}
+		conditions := []string{}
+		for _, condition := range hpa.Conditions {
+			conditions = append(conditions, fmt.Sprintf("%s=%s(%s)", condition.Type, condition.Status, condition.Reason))
+		}
+		rows = append(rows, tableRow{
+			"hpa":          hpa.Name,
+			"namespace":    hpa.Namespace,
+			"target":       hpa.Target.Kind + "/" + hpa.Target.Name,
+			"min":          strconv.Itoa(int(hpa.MinReplicas)),
+			"max":          strconv.Itoa(int(hpa.MaxReplicas)),
+			"current":      strconv.Itoa(int(hpa.CurrentReplicas)),
+			"desired":      strconv.Itoa(int(hpa.DesiredReplicas)),
+			"cpu":          current + "/" + target,
+			"measured-cpu": optionalString(hpa.MeasuredCPU, hpa.MeasuredCPU != nil),
+			"conditions":   strings.Join(conditions, ", "),
+			"flags":        strings.Join(hpa.Flags, ", "),
+		})
+	}
+	outputData("hpa", rows)
+}
+
+// spreadString counts by key, largest first
+func spreadString(counts map[string]int) string {
+	keys := []string{}
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := []string{}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s:%d", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func outputRisks(report *kubeinfo.RiskReport) {
+	rows := []tableRow{}
+	for _, container := range report.Containers {
+		rows = append(rows, tableRow{
+			"pod":        container.Pod,
+			"namespace":  container.Namespace,
+			"container":  container.Container,
+			"node":       container.Node,
+			"cpu-limit":  optionalString(container.CPULimit, container.CPULimit != nil),
+			"throttled%": optionalString(container.ThrottledPercent, container.ThrottledPercent != nil),
+			"mem":        optionalString(container.WorkingSet, container.WorkingSet != nil),
+			"mem-limit":  optionalString(container.MemoryLimit, container.MemoryLimit != nil),
+			"mem-limit%": optionalString(container.MemoryPercent, container.MemoryPercent != nil),
+			"risk":       strings.Join(container.Risks, "; "),
+		})
+	}
+	outputData("risk", rows)
+}
+
+func outputSpread(report *kubeinfo.SpreadReport) {
+	dropUnavailable("spread", report.Unavailable)
+	rows := []tableRow{}
+	for _, workload := range report.Workloads {
+		rows = append(rows, tableRow{
+			"workload":    workload.Kind + "/" + workload.Name,
+			"namespace":   workload.Namespace,
+			"replicas":    strconv.Itoa(int(workload.Replicas)),
+			"ready":       strconv.Itoa(workload.ReadyReplicas),
+			"nodes":       strconv.Itoa(len(workload.Nodes)),
+			"zones":       strconv.Itoa(len(workload.Zones)),
+			"node-spread": spreadString(workload.Nodes),
+			"zone-spread": spreadString(workload.Zones),
+			"pdb":         workload.DisruptionBudget,
+			"flags":       strings.Join(workload.Flags, ", "),
+		})
+	}
+	outputData("spread", rows)
 }
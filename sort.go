@@ -1,13 +0,0 @@
-package main
-
-type byName [][]string
-
-func (s byName) Len() int {
-	return len(s)
-}
-func (s byName) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-func (s byName) Less(i, j int) bool {
-	return s[i][0] < s[j][0]
-}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+
+	"github.com/marc-harry/k8s-info/kubeinfo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podStream writes pods as their pages arrive, one JSON object per line or CSV rows under a single header,
+// so nothing is held beyond the current page
+type podStream struct {
+	service *KubeInfoService
+	encoder *json.Encoder
+	csv     *csv.Writer
+	columns []column
+	// started whether the unavailable data has been noted and any header written
+	started bool
+}
+
+func newPodStream(service *KubeInfoService) *podStream {
+	if outputFormat == formatJSON {
+		return &podStream{service: service, encoder: json.NewEncoder(os.Stdout)}
+	}
+	return &podStream{service: service, csv: csv.NewWriter(os.Stdout)}
+}
+
+// header note the unavailable data and write the CSV header without its columns,
+// once namespace discovery has run so the namespace column can be chosen
+func (stream *podStream) header(unavailable []string) error {
+	if stream.started {
+		return nil
+	}
+	stream.started = true
+	dropUnavailable("pods", unavailable)
+	if stream.csv == nil {
+		return nil
+	}
+	collector := stream.service.Collector
+	if collector.Namespace == v1.NamespaceAll || collector.AccessibleNamespaces != nil {
+		showColumn("pods", "namespace")
+	}
+	stream.columns = selectedColumns("pods")
+	headers := []string{}
+	for _, col := range stream.columns {
+		headers = append(headers, col.Header)
+	}
+	stream.csv.Write(headers)
+	stream.csv.Flush()
+	return stream.csv.Error()
+}
+
+// page write the pods of a page
+func (stream *podStream) page(pods []kubeinfo.PodStats, unavailable []string) error {
+	if err := stream.header(unavailable); err != nil {
+		return err
+	}
+	if stream.encoder != nil {
+		for _, pod := range pods {
+			if err := stream.encoder.Encode(pod); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, pod := range pods {
+		row := podRow(pod)
+		cells := []string{}
+		for _, col := range stream.columns {
+			cells = append(cells, row[col.Name])
+		}
+		stream.csv.Write(cells)
+	}
+	stream.csv.Flush()
+	return stream.csv.Error()
+}
+
+// streamPods write the pods as pages arrive from the API server, then any non fatal errors
+func streamPods(service *KubeInfoService) error {
+	stream := newPodStream(service)
+	report, err := service.Collector.StreamPods(stream.page)
+	if err != nil {
+		return err
+	}
+	// a header even when there are no pods
+	if err := stream.header(report.Unavailable); err != nil {
+		return err
+	}
+	outputErrors(report.Errors)
+	return nil
+}
@@ -4,9 +4,6 @@ import (
 	"fmt"
 	"os"
 	"time"
-
-	inf "gopkg.in/inf.v0"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func asString(res interface{}) string {
@@ -20,22 +17,21 @@ func homeDir() string {
 	return os.Getenv("USERPROFILE") // windows
 }
 
-func getPercentage(first *resource.Quantity, second *resource.Quantity) *inf.Dec {
-	val := new(inf.Dec).QuoRound(first.AsDec(), second.AsDec(), 2, inf.RoundCeil)
-	per := new(inf.Dec).Mul(val, inf.NewDec(100, 0))
-	return per
-}
-
 const (
 	maxDuration time.Duration = 1<<63 - 1
 )
 
 func getTimeSince(value time.Time) string {
-	upTimeUnit := "d"
 	upTime := time.Since(value)
 	if upTime == maxDuration {
 		return ""
 	}
+	return formatDuration(upTime)
+}
+
+// formatDuration duration in its largest whole unit, as the duration columns show it
+func formatDuration(upTime time.Duration) string {
+	upTimeUnit := "d"
 	upTimeValue := upTime.Hours() / float64(24)
 	if upTimeValue >= 1 {
 		upTimeUnit = "d"
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// maxBackoff longest wait between refreshes after repeated failures, unless the interval is longer
+const maxBackoff = 5 * time.Minute
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// backoff wait before the next refresh, doubling the interval for each failure in a row
+func backoff(interval time.Duration, failures int) time.Duration {
+	limit := maxBackoff
+	if interval > limit {
+		limit = interval
+	}
+	wait := interval
+	for i := 1; i < failures && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// watch refresh the command every interval, measured from the start of each refresh, until SIGINT or SIGTERM.
+// Failed refreshes leave the last output in place and are retried with exponential backoff.
+func watch(service *KubeInfoService, cmd *command, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	redrawScreen = outputFormat == formatTable && terminal.IsTerminal(int(os.Stdout.Fd()))
+
+	failures := 0
+	for {
+		start := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- cmd.Run(service) }()
+		var err error
+		select {
+		case err = <-done:
+		case <-signals:
+			// a refresh in progress is abandoned, its output would be incomplete anyway
+			fmt.Println()
+			return
+		}
+
+		wait := interval
+		if err != nil {
+			failures++
+			wait = backoff(interval, failures)
+			fmt.Fprintf(os.Stderr, "%s refresh failed (%d in a row), retrying in %s: %v\n",
+				time.Now().Format("15:04:05"), failures, wait, err)
+		} else {
+			failures = 0
+			service.noteNamespaces()
+		}
+
+		select {
+		case <-time.After(time.Until(start.Add(wait))):
+		case <-signals:
+			return
+		}
+	}
+}